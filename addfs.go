@@ -0,0 +1,162 @@
+package lha
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// AddOptions is options for AddFS and AddPath.
+type AddOptions struct {
+	// Include is patterns of path.Match for files to be added.  A file is
+	// added when its path or base name matches one of them.  All files are
+	// added when it is empty.  Directories are not filtered by Include.
+	Include []string
+	// Exclude is patterns of path.Match for files and directories to be
+	// skipped.  It is matched same as Include, and precedes Include.
+	Exclude []string
+
+	// Method returns a method to compress a regular file of name.  Files are
+	// compressed with -lh5- when it is nil or returns "".
+	Method func(name string, fi fs.FileInfo) string
+}
+
+// matchAny reports whether name or its base name matches one of patterns.
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pat := range patterns {
+		for _, s := range []string{name, path.Base(name)} {
+			ok, err := path.Match(pat, s)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (opts *AddOptions) method(name string, fi fs.FileInfo) string {
+	if opts.Method != nil {
+		if m := opts.Method(name, fi); m != "" {
+			return m
+		}
+	}
+	return "-lh5-"
+}
+
+// readLinkFS is a file system which supports symbolic links.  It is same as
+// fs.ReadLinkFS, which is added in Go 1.25.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// AddFS adds files from fsys to the archive, walking the tree in lexical
+// order.  Directories are added as -lhd-, and symbolic links are added as
+// -lhd- with the target after "|" when fsys supports them.  Metadata of
+// headers are taken from fs.FileInfo: modification time, UNIX permission,
+// owners and DOS attributes.  Other types of files are rejected.
+func (w *Writer) AddFS(fsys fs.FS, opts *AddOptions) error {
+	if opts == nil {
+		opts = &AddOptions{}
+	}
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if ok, err := matchAny(opts.Exclude, name); err != nil {
+			return err
+		} else if ok {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && len(opts.Include) > 0 {
+			if ok, err := matchAny(opts.Include, name); err != nil || !ok {
+				return err
+			}
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := w.addFile(fsys, name, fi, opts); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+func (w *Writer) addFile(fsys fs.FS, name string, fi fs.FileInfo, opts *AddOptions) error {
+	mode := fi.Mode()
+	var link string
+	switch {
+	case mode.IsDir(), mode.IsRegular():
+	case mode&fs.ModeSymlink != 0:
+		lfs, ok := fsys.(readLinkFS)
+		if !ok {
+			return fmt.Errorf("lha: symbolic link is not supported by %T", fsys)
+		}
+		var err error
+		link, err = lfs.ReadLink(name)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("lha: unsupported file mode: %s", mode)
+	}
+
+	h := headerFromInfo(name, fi, link, opts.method(name, fi))
+	// tar knows how to get owners of the file from platform specific
+	// fs.FileInfo.Sys().
+	if th, err := tar.FileInfoHeader(fi, link); err == nil {
+		if th.Uid >= 0 && th.Uid <= 0xffff && th.Gid >= 0 && th.Gid <= 0xffff {
+			h.UNIX.UID = uint16(th.Uid)
+			h.UNIX.GID = uint16(th.Gid)
+		}
+		h.UNIX.User = th.Uname
+		h.UNIX.Group = th.Gname
+	}
+	fw, err := w.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	if !mode.IsRegular() {
+		return nil
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(fw, f)
+	return err
+}
+
+// dirFS is os.DirFS which supports symbolic links.
+type dirFS struct {
+	fs.FS
+	root string
+}
+
+func (d dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+// AddPath adds files in a directory tree at root to the archive, like AddFS.
+// Paths in the archive are relative to root.
+func (w *Writer) AddPath(root string, opts *AddOptions) error {
+	return w.AddFS(dirFS{FS: os.DirFS(root), root: root}, opts)
+}
@@ -0,0 +1,99 @@
+package lha
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testAddFS(t *testing.T, add func(w *Writer) error) ([]*Header, [][]byte) {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if err := add(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return testReadAll(t, b.Bytes())
+}
+
+func TestWriter_AddFS(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a.txt":         {Data: []byte("Hello"), Mode: 0644, ModTime: mtime},
+		"ro.txt":        {Data: []byte("read only"), Mode: 0444, ModTime: mtime},
+		"sub":           {Mode: fs.ModeDir | 0750, ModTime: mtime},
+		"sub/b.go":      {Data: []byte("package b"), Mode: 0600, ModTime: mtime},
+		"sub/c.txt":     {Data: []byte("C"), Mode: 0644, ModTime: mtime},
+		"tmp/x.txt":     {Data: []byte("excluded"), Mode: 0644, ModTime: mtime},
+		"sub/d.tmp.txt": {Data: []byte("excluded"), Mode: 0644, ModTime: mtime},
+	}
+	headers, bodies := testAddFS(t, func(w *Writer) error {
+		return w.AddFS(fsys, &AddOptions{
+			Include: []string{"*.txt", "*.go"},
+			Exclude: []string{"tmp", "*.tmp.*"},
+			Method: func(name string, fi fs.FileInfo) string {
+				if fi.Size() < 5 {
+					return "-lh0-"
+				}
+				return ""
+			},
+		})
+	})
+	var (
+		paths   []string
+		methods []string
+	)
+	for _, h := range headers {
+		paths = append(paths, h.slashPath())
+		methods = append(methods, h.Method)
+		if !h.Time.Equal(mtime) {
+			t.Errorf("time mismatch for %s: %s", h.slashPath(), h.Time)
+		}
+	}
+	assert.Equal(t, []string{"a.txt", "ro.txt", "sub/", "sub/b.go", "sub/c.txt"}, paths)
+	assert.Equal(t, []string{"-lh5-", "-lh5-", "-lhd-", "-lh5-", "-lh0-"}, methods)
+	assert.Equal(t, "package b", string(bodies[3]))
+	assert.Equal(t, fs.ModeDir|0750, headers[2].Mode())
+	assert.Equal(t, uint8(0x10), headers[2].Attribute)
+	assert.Equal(t, uint8(0x21), headers[1].Attribute)
+	assert.Equal(t, fs.FileMode(0600), headers[3].Mode())
+}
+
+func TestWriter_AddPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("Hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(root, "sub", "link")); err != nil {
+		t.Fatal(err)
+	}
+	headers, bodies := testAddFS(t, func(w *Writer) error {
+		return w.AddPath(root, nil)
+	})
+	var paths []string
+	for _, h := range headers {
+		paths = append(paths, h.slashPath())
+	}
+	assert.Equal(t, []string{"sub/", "sub/a.txt", "sub/link"}, paths)
+	assert.Equal(t, "Hello", string(bodies[1]))
+	assert.Equal(t, fs.FileMode(0640), headers[1].Mode())
+	assert.Equal(t, uint16(os.Getuid()), headers[1].UNIX.UID)
+	assert.Equal(t, "a.txt", headers[2].Linkname())
+	assert.Equal(t, fs.ModeSymlink, headers[2].Mode().Type())
+}
@@ -0,0 +1,164 @@
+package lha
+
+import (
+	"errors"
+	"io"
+)
+
+var errNoEndMarker = errors.New("lha: end marker of the archive not found")
+
+// appender writes new entries after the end marker of an existing archive.
+// The first byte of new data is held, and overwrites the end marker at commit.
+// So the archive keeps to end at the original marker until all new entries
+// and the new end marker are written, and it is never corrupted by a crash.
+type appender struct {
+	rws   io.ReadWriteSeeker
+	end   int64
+	first []byte
+
+	// size is the original size of the archive, and trailing is data after
+	// the original end marker, to be restored by rollback.
+	size     int64
+	trailing []byte
+}
+
+type syncer interface {
+	Sync() error
+}
+
+type truncater interface {
+	Truncate(size int64) error
+}
+
+func (a *appender) Write(p []byte) (int, error) {
+	var n int
+	if a.first == nil && len(p) > 0 {
+		a.first = []byte{p[0]}
+		p = p[1:]
+		n++
+	}
+	m, err := a.rws.Write(p)
+	return n + m, err
+}
+
+func (a *appender) sync() error {
+	if s, ok := a.rws.(syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// commit discards data after the new end marker, and replaces the original
+// end marker by the first byte of new data.
+func (a *appender) commit() error {
+	if a.first == nil || a.first[0] == 0 {
+		// nothing appended.
+		return nil
+	}
+	if t, ok := a.rws.(truncater); ok {
+		size, err := a.rws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if err := t.Truncate(size); err != nil {
+			return err
+		}
+	}
+	if err := a.sync(); err != nil {
+		return err
+	}
+	if _, err := a.rws.Seek(a.end, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := a.rws.Write(a.first); err != nil {
+		return err
+	}
+	return a.sync()
+}
+
+// rollback restores the original end marker, which commit may have replaced,
+// and data after it.  Appended data beyond the original size is discarded
+// when the underlying file supports truncation.  Otherwise it is left after
+// the end marker, and it is ignored by readers.
+func (a *appender) rollback() error {
+	if _, err := a.rws.Seek(a.end, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := a.rws.Write([]byte{0}); err != nil {
+		return err
+	}
+	if _, err := a.rws.Write(a.trailing); err != nil {
+		return err
+	}
+	if t, ok := a.rws.(truncater); ok {
+		return t.Truncate(a.size)
+	}
+	return nil
+}
+
+// NewAppendWriter creates a new Writer which appends files to an existing
+// archive in rws, such as *os.File opened with os.O_RDWR.  The archive is
+// updated at Close, which writes the new end marker and then replaces the
+// original end marker.  So the original archive is kept when writing fails or
+// the process crashes before Close completes.  Appended data are discarded on
+// failures of Close, if rws supports Truncate like *os.File.  Data after the
+// original end marker is overwritten by appended files, and the rest of it is
+// truncated at Close.  It is kept in memory, and restored on failures.
+func NewAppendWriter(rws io.ReadWriteSeeker) (*Writer, error) {
+	return NewAppendWriterWithOptions(rws, nil)
+}
+
+// NewAppendWriterWithOptions is NewAppendWriter which reads the archive with
+// opts.  The location of opts is used to write new headers too.
+func NewAppendWriterWithOptions(rws io.ReadWriteSeeker, opts *ReaderOptions) (*Writer, error) {
+	if _, err := rws.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	lr := NewReaderWithOptions(rws, opts)
+	var end int64
+	for {
+		h, err := lr.NextHeader()
+		if err != nil {
+			return nil, err
+		}
+		if h == nil {
+			break
+		}
+		end = lr.bodyOffset + int64(h.bodySize())
+	}
+	if _, err := rws.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	// write the end marker when the archive lacks it.
+	var b [1]byte
+	if _, err := io.ReadFull(rws, b[:]); err == io.EOF {
+		if _, err := rws.Write(b[:]); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if b[0] != 0 {
+		return nil, errNoEndMarker
+	}
+	size, err := rws.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rws.Seek(end+1, io.SeekStart); err != nil {
+		return nil, err
+	}
+	a := &appender{rws: rws, end: end, size: size}
+	a.trailing, err = io.ReadAll(rws)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rws.Seek(end+1, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w := NewWriter(a)
+	w.appender = a
+	if opts != nil {
+		w.SetLocation(opts.Location)
+	}
+	return w, nil
+}
@@ -0,0 +1,228 @@
+package lha
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testAppendFile(t *testing.T, b []byte) *os.File {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "archive.lzh")
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func testReadFile(t *testing.T, f *os.File) []byte {
+	t.Helper()
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testAppendNames(t *testing.T, b []byte) []string {
+	t.Helper()
+	headers, _ := testReadAll(t, b)
+	var names []string
+	for _, h := range headers {
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func TestNewAppendWriter(t *testing.T) {
+	orig := testBuildArchive(t,
+		testFile{"a.txt", "-lh5-", "Hello"},
+		testFile{"b.txt", "-lh0-", "LHA"},
+	)
+	for _, tc := range []struct {
+		name string
+		orig []byte
+		want []string
+	}{
+		{"archive", orig, []string{"a.txt", "b.txt", "c.txt"}},
+		{"without end marker", orig[:len(orig)-1], []string{"a.txt", "b.txt", "c.txt"}},
+		{"empty", nil, []string{"c.txt"}},
+		{"trailing data", append(orig, bytes.Repeat([]byte("trailing"), 100)...), []string{"a.txt", "b.txt", "c.txt"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := testAppendFile(t, tc.orig)
+			w, err := NewAppendWriter(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw, err := w.CreateHeader(&Header{Method: "-lh5-", Name: "c.txt"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(fw, "appended")
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			b := testReadFile(t, f)
+			assert.Equal(t, tc.want, testAppendNames(t, b))
+			_, bodies := testReadAll(t, b)
+			assert.Equal(t, "appended", string(bodies[len(bodies)-1]))
+			assert.Equal(t, byte(0), b[len(b)-1])
+		})
+	}
+}
+
+func TestNewAppendWriter_Rollback(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	f := testAppendFile(t, orig)
+	w, err := NewAppendWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "written")
+	// an entry with short raw data makes Close fail.
+	if _, err := w.CreateRaw(&Header{Method: "-lh0-", Name: "c.txt", PackedSize: 10, OriginalSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("Close should fail")
+	}
+	if b := testReadFile(t, f); !bytes.Equal(orig, b) {
+		t.Fatalf("archive is not rolled back: %d bytes", len(b))
+	}
+}
+
+// failSyncFile is a file which Sync fails at the n-th call.
+type failSyncFile struct {
+	*os.File
+	n int
+}
+
+func (f *failSyncFile) Sync() error {
+	f.n--
+	if f.n == 0 {
+		return errors.New("sync failed")
+	}
+	return f.File.Sync()
+}
+
+func TestNewAppendWriter_RollbackMarker(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	f := testAppendFile(t, orig)
+	// Sync fails after the original end marker is replaced.
+	w, err := NewAppendWriter(&failSyncFile{File: f, n: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "written")
+	if err := w.Close(); err == nil {
+		t.Fatal("Close should fail")
+	}
+	if b := testReadFile(t, f); !bytes.Equal(orig, b) {
+		t.Fatalf("archive is not rolled back: %d bytes", len(b))
+	}
+}
+
+func TestNewAppendWriter_CloseTwice(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	f := testAppendFile(t, orig)
+	w, err := NewAppendWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "appended")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a deferred Close after the explicit one doesn't roll back.
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a.txt", "b.txt"}, testAppendNames(t, testReadFile(t, f)))
+}
+
+func TestNewAppendWriter_RollbackTrailing(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	orig = append(orig, bytes.Repeat([]byte("trailing"), 100)...)
+	f := testAppendFile(t, orig)
+	w, err := NewAppendWriter(&failSyncFile{File: f, n: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "written")
+	if err := w.Close(); err == nil {
+		t.Fatal("Close should fail")
+	}
+	// data after the end marker is restored.
+	if b := testReadFile(t, f); !bytes.Equal(orig, b) {
+		t.Fatalf("archive is not rolled back: %d bytes", len(b))
+	}
+}
+
+func TestNewAppendWriter_KeepTrailing(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	orig = append(orig, "trailing"...)
+	f := testAppendFile(t, orig)
+	w, err := NewAppendWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// data after the end marker is kept until files are appended.
+	if b := testReadFile(t, f); !bytes.Equal(orig, b) {
+		t.Fatal("archive is modified before Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b := testReadFile(t, f); !bytes.Equal(orig, b) {
+		t.Fatal("archive is modified without appended files")
+	}
+}
+
+func TestNewAppendWriter_Crash(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	f := testAppendFile(t, orig)
+	w, err := NewAppendWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.txt", "c.txt"} {
+		fw, err := w.CreateHeader(&Header{Method: "-lh0-", Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, "not committed")
+	}
+	// the archive is still valid without Close.
+	b := testReadFile(t, f)
+	if len(b) <= len(orig) {
+		t.Fatal("appended data should be written")
+	}
+	assert.Equal(t, []string{"a.txt"}, testAppendNames(t, b))
+}
@@ -1,56 +1,53 @@
 package bitio
 
 import (
+	"encoding/binary"
 	"io"
 )
 
-type paddingReader struct {
-	l *io.LimitedReader
-}
-
-// Read reads data from based io.LimitedReader. but it pads zero bytes when try
-// to read data over limitation.
-func (pr *paddingReader) Read(b []byte) (int, error) {
-	n := len(b)
-	if int64(n) <= pr.l.N {
-		return pr.l.Read(b)
-	}
-	m, err := pr.l.Read(b[:int(pr.l.N)])
-	if err != nil {
-		return m, err
-	}
-	for i := m; i < n; i++ {
-		b[i] = 0
-	}
-	return n, nil
-}
-
-func wrapRead(r io.Reader) io.Reader {
-	if l, ok := r.(*io.LimitedReader); ok {
-		return &paddingReader{l: l}
-	}
-	return r
-}
+const bufferSize = 4096
 
 // Reader is a reader of bit stream.
+//
+// Reader reads underlying io.Reader in large chunks and keeps up to 64 bits
+// in an accumulator, which is refilled by whole words when possible.
 type Reader struct {
-	rd    io.Reader
-	buf   [8]byte
-	curr  bits
-	ahead bits
+	rd   io.Reader
+	buf  []byte
+	r, w int
+	err  error
+	curr bits
+
+	// nread is number of bytes read from rd.
+	nread int64
 }
 
 // NewReader creates a bit stream reader.
 func NewReader(rd io.Reader) *Reader {
 	return &Reader{
-		rd: wrapRead(rd),
+		rd:  rd,
+		buf: make([]byte, bufferSize),
 	}
 }
 
+// Reset discards all buffered data, and resets the reader to read from rd.
+func (r *Reader) Reset(rd io.Reader) {
+	r.rd = rd
+	r.r, r.w = 0, 0
+	r.err = nil
+	r.curr = bits{}
+	r.nread = 0
+}
+
 // NBits returns number of available bits without accessing underlying
 // io.Reader.
 func (r *Reader) NBits() uint {
-	return r.curr.n + r.ahead.n
+	return r.curr.n + uint(r.w-r.r)*8
+}
+
+// Offset returns number of bits consumed from the stream.
+func (r *Reader) Offset() int64 {
+	return r.nread*8 - int64(r.w-r.r)*8 - int64(r.curr.n)
 }
 
 // ReadBits reads bits up to 64.
@@ -58,6 +55,19 @@ func (r *Reader) ReadBits(n uint) (uint64, error) {
 	if n > 64 {
 		return 0, ErrTooMuchBits
 	}
+	if n > 56 {
+		// the accumulator can't be refilled to more than 56 bits with
+		// whole bytes, so read long values in two steps.
+		hi, err := r.readBits(n - 32)
+		if err != nil {
+			return 0, err
+		}
+		lo, err := r.readBits(32)
+		if err != nil {
+			return 0, err
+		}
+		return hi<<32 | lo, nil
+	}
 	return r.readBits(n)
 }
 
@@ -113,23 +123,42 @@ func (r *Reader) SkipBit() error {
 
 func (r *Reader) readBits(n uint) (uint64, error) {
 	if n > r.curr.n {
-		err := r.loadBits(n - r.curr.n)
-		if err != nil {
-			return 0, err
-		}
+		return r.readBitsSlow(n)
+	}
+	d := r.curr.v >> (64 - n)
+	r.curr.v <<= n
+	r.curr.n -= n
+	return d, nil
+}
+
+func (r *Reader) readBitsSlow(n uint) (uint64, error) {
+	if err := r.ensure(n); err != nil {
+		return 0, err
 	}
-	return r.curr.read(n)
+	return r.readBits(n)
 }
 
-// PeekBits peeks some bits.
+// PeekBits peeks some bits, up to 56.
 func (r *Reader) PeekBits(n uint) (uint64, error) {
+	if n > 56 {
+		return 0, ErrTooMuchBits
+	}
 	if n > r.curr.n {
-		err := r.loadBits(n - r.curr.n)
-		if err != nil {
+		if err := r.ensure(n); err != nil {
 			return 0, err
 		}
 	}
-	return r.curr.peek(n)
+	return r.curr.v >> (64 - n), nil
+}
+
+// Lookahead returns next n bits (up to 56) without consuming them.  Bits
+// beyond the end of stream are filled with zero, so it never fails.  Use
+// SkipBits to consume bits and to detect the end of stream.
+func (r *Reader) Lookahead(n uint) uint64 {
+	if n > r.curr.n {
+		r.refill()
+	}
+	return r.curr.v >> (64 - n)
 }
 
 // CountTrues counts continuous true bits.
@@ -146,56 +175,101 @@ func (r *Reader) CountTrues(n uint) (uint, error) {
 	return n, nil
 }
 
-// SkipBits skips some bits.
+// SkipBits skips some bits, up to 56.
 func (r *Reader) SkipBits(n uint) error {
 	if n > r.curr.n {
-		err := r.loadBits(n - r.curr.n)
-		if err != nil {
-			return err
-		}
+		return r.skipBitsSlow(n)
 	}
-	return r.curr.skip(n)
+	r.curr.v <<= n
+	r.curr.n -= n
+	return nil
 }
 
-// loadBits loads at least n bits.
-func (r *Reader) loadBits(nbits uint) error {
-	if nbits > 64 {
+func (r *Reader) skipBitsSlow(n uint) error {
+	if n > 56 {
 		return ErrTooMuchBits
 	}
-	for {
-		if nbits -= r.loadAhead(nbits); nbits == 0 {
-			return nil
+	if err := r.ensure(n); err != nil {
+		return err
+	}
+	return r.SkipBits(n)
+}
+
+// Accumulator returns bits in the accumulator, which are aligned to MSB of
+// v, and number of them.  Decoders can keep them in local variables in their
+// hot loops, and give them back with SetAccumulator.
+func (r *Reader) Accumulator() (v uint64, n uint) {
+	return r.curr.v, r.curr.n
+}
+
+// SetAccumulator sets bits in the accumulator, which are returned by
+// Accumulator and then consumed partially.
+func (r *Reader) SetAccumulator(v uint64, n uint) {
+	r.curr.v, r.curr.n = v, n
+}
+
+// Refill loads bytes into the accumulator, to have more than 56 bits unless
+// the end of stream.
+func (r *Reader) Refill() {
+	r.refill()
+}
+
+// ensure makes at least n (up to 56) bits available in the accumulator.
+func (r *Reader) ensure(n uint) error {
+	r.refill()
+	if n <= r.curr.n {
+		return nil
+	}
+	if r.err == io.EOF && r.curr.n != 0 {
+		return ErrTooLessBits
+	}
+	return r.err
+}
+
+// refill loads bytes into the accumulator until it has more than 56 bits or
+// the underlying io.Reader is exhausted.
+func (r *Reader) refill() {
+	for r.curr.n <= 56 {
+		if r.w-r.r >= 8 {
+			// load whole bytes from a word at once.
+			v := binary.BigEndian.Uint64(r.buf[r.r:])
+			k := (64 - r.curr.n) / 8
+			nbits := k * 8
+			r.curr.v |= (v >> (64 - nbits) << (64 - nbits)) >> r.curr.n
+			r.curr.n += nbits
+			r.r += int(k)
+			return
 		}
-		nbytes := int((nbits + 7) / 8)
-		n, err := r.rd.Read(r.buf[:nbytes])
-		if n > 0 {
-			r.ahead.set(r.buf[:n])
+		if r.r < r.w {
+			r.curr.v |= uint64(r.buf[r.r]) << (56 - r.curr.n)
+			r.curr.n += 8
+			r.r++
 			continue
 		}
-		if err != nil {
-			if err == io.EOF && r.curr.n+r.ahead.n != 0 {
-				//// supply zero bits if there are some bits remained.
-				//err := r.ahead.write(0, nbits)
-				//if err != nil {
-				//	return err
-				//}
-				//continue
-				return ErrTooLessBits
-			}
-			return err
+		if r.err != nil {
+			return
 		}
+		r.fill()
 	}
 }
 
-func (r *Reader) loadAhead(nbits uint) uint {
-	if r.ahead.n == 0 {
-		return 0
+// fill reads data from underlying io.Reader into the buffer.
+func (r *Reader) fill() {
+	if r.r > 0 {
+		copy(r.buf, r.buf[r.r:r.w])
+		r.w -= r.r
+		r.r = 0
 	}
-	n := nbits
-	if n > r.ahead.n {
-		n = r.ahead.n
+	for r.w < len(r.buf) {
+		n, err := r.rd.Read(r.buf[r.w:])
+		r.w += n
+		r.nread += int64(n)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
 	}
-	d, _ := r.ahead.read(n)
-	r.curr.write(d, n)
-	return n
 }
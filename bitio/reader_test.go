@@ -49,3 +49,42 @@ func TestReaderReadBits(t *testing.T) {
 		{1, 0, io.EOF},
 	})
 }
+
+func TestReaderOffset(t *testing.T) {
+	r := NewReader(bytes.NewReader(make([]byte, 100)))
+	var want int64
+	for _, n := range []uint{3, 5, 16, 1, 40, 7, 64, 9} {
+		if _, err := r.ReadBits(n); err != nil {
+			t.Fatal(err)
+		}
+		want += int64(n)
+		assert.Equal(t, want, r.Offset())
+	}
+	r.Lookahead(16)
+	assert.Equal(t, want, r.Offset())
+	if err := r.SkipBits(20); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want+20, r.Offset())
+}
+
+func TestReaderAccumulator(t *testing.T) {
+	d := []byte{0xD2, 0x20, 0x5a, 0xff, 0x01, 0x80, 0x33, 0x44, 0x55, 0x66, 0x77}
+	r1 := NewReader(bytes.NewReader(d))
+	r2 := NewReader(bytes.NewReader(d))
+	for _, n := range []uint{3, 13, 20, 7, 30, 15} {
+		want, err := r1.ReadBits(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// consume bits in local variables, as decoders do.
+		v, nbits := r2.Accumulator()
+		if nbits < n {
+			r2.Refill()
+			v, nbits = r2.Accumulator()
+		}
+		assert.Equal(t, want, v>>(64-n))
+		r2.SetAccumulator(v<<n, nbits-n)
+		assert.Equal(t, r1.Offset(), r2.Offset())
+	}
+}
@@ -1,57 +1,79 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
 
 	"github.com/koron-go/lha"
 )
 
-func extract(r *lha.Reader, h *lha.Header) error {
-	if h.Dir != "" {
-		err := os.MkdirAll(h.Dir, 0777)
-		if err != nil {
-			return err
-		}
-	}
-	name := filepath.Join(h.Dir, h.Name)
-	f, err := os.Create(name)
-	if err != nil {
-		return err
-	}
-	n, err := r.Decode(f)
-	f.Close()
+// progress prints results of extracted files.
+type progress struct {
+	out int64
+}
+
+func (p *progress) StartEntry(h *lha.Header) {
+	p.out = 0
+}
+
+func (p *progress) Progress(h *lha.Header, in, out int64) {
+	p.out = out
+}
+
+func (p *progress) EndEntry(h *lha.Header, err error) {
 	if err != nil {
-		os.Remove(name)
-		return err
+		return
 	}
-	fmt.Printf("%s - %d bytes decoded\n", name, n)
+	fmt.Printf("%s - %d bytes decoded\n", h.Path(), p.out)
+}
+
+// patterns is a flag which can be specified multiple times.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(s string) error {
+	*p = append(*p, s)
 	return nil
 }
 
 func main() {
+	var include, exclude patterns
+	dir := flag.String("C", ".", "directory to extract files into")
+	flag.Var(&include, "include", "pattern of paths to be extracted (repeatable)")
+	flag.Var(&exclude, "exclude", "pattern of paths to be skipped (repeatable)")
+	strip := flag.Int("strip-components", 0, "number of leading path elements to be removed")
+	junk := flag.Bool("junk-paths", false, "extract files without directories, like \"lha e\"")
+	overwrite := flag.String("overwrite", "always", "policy for existing files: always, skip, newer or rename")
 	flag.Parse()
+	policy, err := lha.ParseOverwritePolicy(*overwrite)
+	if err != nil {
+		log.Fatal(err)
+	}
 	name := flag.Arg(0)
 	f, err := os.Open(name)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer f.Close()
-	r := lha.NewReader(f)
-	for {
-		h, err := r.NextHeader()
-		if err != nil {
-			log.Fatal(err)
-		}
-		if h == nil {
-			break
-		}
-		err = extract(r, h)
-		if err != nil {
-			log.Fatal(err)
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = lha.Extract(ctx, f, *dir, &lha.ExtractOptions{
+		Observer:        &progress{},
+		Include:         include,
+		Exclude:         exclude,
+		StripComponents: *strip,
+		JunkPaths:       *junk,
+		Overwrite:       policy,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 }
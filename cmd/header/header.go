@@ -4,28 +4,55 @@ import (
 	"flag"
 	"log"
 	"os"
+	"time"
 
 	"github.com/koron-go/lha"
 	"github.com/kr/pretty"
 )
 
+func dump(f *os.File, opts *lha.ReaderOptions) error {
+	r := lha.NewReaderWithOptions(f, opts)
+	for {
+		h, err := r.NextHeader()
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			return nil
+		}
+		pretty.Println(h)
+	}
+}
+
 func main() {
+	format := flag.String("format", "pretty", `output format: "pretty", "json" or "csv"`)
+	location := flag.String("location", "", `location of DOS timestamps, such as "UTC" (default: local)`)
 	flag.Parse()
+	opts := &lha.ReaderOptions{}
+	if *location != "" {
+		loc, err := time.LoadLocation(*location)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Location = loc
+	}
 	name := flag.Arg(0)
 	f, err := os.Open(name)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer f.Close()
-	r := lha.NewReader(f)
-	for {
-		h, err := r.NextHeader()
-		if err != nil {
-			log.Fatal(err)
-		}
-		if h == nil {
-			break
-		}
-		pretty.Println(h)
+	switch *format {
+	case "pretty":
+		err = dump(f, opts)
+	case "json":
+		err = lha.ListWithOptions(os.Stdout, f, lha.ListJSON, opts)
+	case "csv":
+		err = lha.ListWithOptions(os.Stdout, f, lha.ListCSV, opts)
+	default:
+		log.Fatalf("unknown format: %s", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
 }
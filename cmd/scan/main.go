@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/koron-go/lha"
+)
+
+// extractFile extracts f into dir.  The name is prefixed with the offset of
+// the member, because embedded members may have same names.
+func extractFile(dir string, f *lha.File) error {
+	if f.IsDir() {
+		return nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%08x-%s", f.HeaderOffset(), filepath.Base(f.Path())))
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+func main() {
+	dir := flag.String("x", "", "directory to extract found members into")
+	flag.Parse()
+	name := flag.Arg(0)
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := lha.NewScanner(f, fi.Size())
+	for s.Scan() {
+		m := s.File()
+		fmt.Printf("0x%08x %s lv%d %d/%d %s\n", m.HeaderOffset(), m.Method, m.Level, m.PackedSize, m.OriginalSize, m.Path())
+		if *dir == "" {
+			continue
+		}
+		if err := extractFile(*dir, m); err != nil {
+			log.Printf("failed to extract %s at 0x%08x: %s", m.Path(), m.HeaderOffset(), err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
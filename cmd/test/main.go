@@ -1,56 +1,73 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/koron-go/lha"
 )
 
-func extractTest(r *lha.Reader, h *lha.Header) error {
-	name := filepath.Join(h.Dir, h.Name)
-	n, err := r.Decode(io.Discard)
-	if err != nil {
-		return err
+var jsonOutput bool
+
+func printReport(name string, rp *lha.Report) {
+	fmt.Printf("%s - test as lha\n", name)
+	for _, e := range rp.Entries {
+		if e.Err != nil {
+			fmt.Printf("  %s - %s: %s\n", e.Name, e.Status, e.Err)
+			continue
+		}
+		fmt.Printf("  %s - %d bytes decoded\n", e.Name, e.OriginalSize)
+	}
+	if rp.Err != nil {
+		fmt.Printf("  error: %s\n", rp.Err)
+	}
+	if !rp.EndMarker {
+		fmt.Printf("  no end-of-archive marker\n")
+	}
+	if rp.Trailing > 0 {
+		fmt.Printf("  %d bytes of trailing garbage\n", rp.Trailing)
 	}
-	fmt.Printf("  %s - %d bytes decoded\n", name, n)
-	return nil
 }
 
-func extractLha(name string) error {
+func testLha(name string) (bool, error) {
 	f, err := os.Open(name)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer f.Close()
-	fmt.Printf("%s - extact as lha\n", name)
-	r := lha.NewReader(f)
-	for {
-		h, err := r.NextHeader()
-		if err != nil {
-			return err
-		}
-		if h == nil {
-			break
-		}
-		err = extractTest(r, h)
+	rp, err := lha.Test(f)
+	if err != nil {
+		return false, err
+	}
+	if jsonOutput {
+		err := json.NewEncoder(os.Stdout).Encode(struct {
+			Name   string      `json:"archive"`
+			Report *lha.Report `json:"report"`
+		}{name, rp})
 		if err != nil {
-			return err
+			return false, err
 		}
+	} else {
+		printReport(name, rp)
 	}
-	return nil
+	return rp.OK(), nil
 }
 
 func main() {
+	flag.BoolVar(&jsonOutput, "json", false, "output reports as JSON")
 	flag.Parse()
+	ok := true
 	for _, arg := range flag.Args() {
-		err := extractLha(arg)
+		passed, err := testLha(arg)
 		if err != nil {
 			log.Fatal(err)
 		}
+		ok = ok && passed
+	}
+	if !ok {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/koron-go/lha"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: transcode [OPTIONS] {to-tar|to-zip|from-tar|from-zip} {INPUT} {OUTPUT}
+
+OPTIONS:
+`)
+	flag.PrintDefaults()
+}
+
+func toTar(out io.Writer, in *os.File) error {
+	tw := tar.NewWriter(out)
+	if err := lha.ToTar(tw, in); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func toZip(out io.Writer, in *os.File) error {
+	zw := zip.NewWriter(out)
+	if err := lha.ToZip(zw, in); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func fromTar(method string) func(io.Writer, *os.File) error {
+	return func(out io.Writer, in *os.File) error {
+		w := lha.NewWriter(out)
+		if err := lha.FromTar(w, tar.NewReader(in), method); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+}
+
+func fromZip(method string) func(io.Writer, *os.File) error {
+	return func(out io.Writer, in *os.File) error {
+		fi, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(in, fi.Size())
+		if err != nil {
+			return err
+		}
+		w := lha.NewWriter(out)
+		if err := lha.FromZip(w, zr, method); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+}
+
+func run(conv func(io.Writer, *os.File) error, input, output string) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := conv(out, in); err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	return out.Close()
+}
+
+func main() {
+	method := flag.String("method", "-lh5-", "compression method of LHA archive to write")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var conv func(io.Writer, *os.File) error
+	switch cmd := flag.Arg(0); cmd {
+	case "to-tar":
+		conv = toTar
+	case "to-zip":
+		conv = toZip
+	case "from-tar":
+		conv = fromTar(*method)
+	case "from-zip":
+		conv = fromZip(*method)
+	default:
+		log.Fatalf("unknown subcommand: %s", cmd)
+	}
+	if err := run(conv, flag.Arg(1), flag.Arg(2)); err != nil {
+		log.Fatal(err)
+	}
+}
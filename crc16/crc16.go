@@ -1,9 +1,19 @@
 package crc16
 
+// Size is the size of a CRC-16 checksum in bytes.
+const Size = 2
+
 // Table is a 256-word table representing the polynomial for efficient
 // processing.
 type Table [256]uint16
 
+// slicing8Table is eight tables for slicing-by-8 algorithm, which processes
+// 8 bytes per an iteration.
+type slicing8Table [8]Table
+
+// slicing8Min is the minimum length of data to use slicing-by-8 algorithm.
+const slicing8Min = 16
+
 const (
 	// IBM is by far and away the most common CRC-16 polynomial.
 	IBM = 0xA001
@@ -12,11 +22,20 @@ const (
 var (
 	// IBMTable is the table for the IBM polynomial.
 	IBMTable = MakeTable(IBM)
+
+	// ibmSlicing8Table is slicing-by-8 tables for IBMTable.
+	ibmSlicing8Table = makeSlicing8Table(IBMTable)
 )
 
 // MakeTable returns a Table constructed from the specified polynomial. The
 // contents of this Table must not be modified.
+//
+// Update and Hash16 process data with slicing-by-8 algorithm for IBMTable.
 func MakeTable(poly uint16) *Table {
+	return makeTable(poly)
+}
+
+func makeTable(poly uint16) *Table {
 	t := new(Table)
 	for i := range t {
 		r := uint16(i)
@@ -32,18 +51,65 @@ func MakeTable(poly uint16) *Table {
 	return t
 }
 
+func makeSlicing8Table(t *Table) *slicing8Table {
+	t8 := new(slicing8Table)
+	t8[0] = *t
+	for i := range 256 {
+		crc := t[i]
+		for j := 1; j < 8; j++ {
+			crc = t[crc&0xff] ^ (crc >> 8)
+			t8[j][i] = crc
+		}
+	}
+	return t8
+}
+
+// getSlicing8Table returns slicing-by-8 tables for tab, or nil.
+func getSlicing8Table(tab *Table) *slicing8Table {
+	if tab == IBMTable {
+		return ibmSlicing8Table
+	}
+	return nil
+}
+
 // Update returns the result of adding the bytes in p to the crc.
 func Update(crc uint16, tab *Table, p []byte) uint16 {
+	if len(p) >= slicing8Min {
+		if t8 := getSlicing8Table(tab); t8 != nil {
+			return updateSlicing8(crc, t8, p)
+		}
+	}
+	return update(crc, tab, p)
+}
+
+func update(crc uint16, tab *Table, p []byte) uint16 {
 	for _, b := range p {
 		crc = tab[(crc^uint16(b))&0xff] ^ (crc >> 8)
 	}
 	return crc
 }
 
+func updateSlicing8(crc uint16, t8 *slicing8Table, p []byte) uint16 {
+	for len(p) >= 8 {
+		crc ^= uint16(p[0]) | uint16(p[1])<<8
+		crc = t8[7][crc&0xff] ^ t8[6][crc>>8] ^
+			t8[5][p[2]] ^ t8[4][p[3]] ^ t8[3][p[4]] ^
+			t8[2][p[5]] ^ t8[1][p[6]] ^ t8[0][p[7]]
+		p = p[8:]
+	}
+	return update(crc, &t8[0], p)
+}
+
+// Checksum returns the CRC-16 checksum of data using the polynomial
+// represented by the Table.
+func Checksum(data []byte, tab *Table) uint16 {
+	return Update(0, tab, data)
+}
+
 // New creates a new crc16.Hash16 computing the CRC-16 checksum using the
 // polynomial represented by the Table.  out in big-endian byte order.
 func New(tab *Table) Hash16 {
-	return &hash16{tab: tab}
+	return &hash16{tab: tab, t8: getSlicing8Table(tab)}
 }
 
 // NewIBM creates a new crc16.Hash16 computing the CRC-16 checksum using the
@@ -0,0 +1,71 @@
+package crc16
+
+import (
+	"hash"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+var _ hash.Hash = NewIBM()
+
+func TestChecksum(t *testing.T) {
+	// CRC-16/ARC check value.
+	assert.Equalf(t, Checksum([]byte("123456789"), IBMTable), uint16(0xbb3d), "Checksum(\"123456789\")")
+	assert.Equalf(t, Checksum(nil, IBMTable), uint16(0), "Checksum(nil)")
+}
+
+func TestUpdateSlicing8(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(rnd.Uint32())
+	}
+	// tables other than IBMTable don't use slicing-by-8.
+	plain := MakeTable(IBM)
+	for n := range len(data) {
+		want := Update(0x1234, plain, data[:n])
+		got := Update(0x1234, IBMTable, data[:n])
+		if got != want {
+			t.Fatalf("mismatch for %d bytes: want=%04x got=%04x", n, want, got)
+		}
+	}
+}
+
+func TestMakeTable(t *testing.T) {
+	if getSlicing8Table(MakeTable(IBM)) != nil {
+		t.Fatal("MakeTable should not make slicing-by-8 tables")
+	}
+	if getSlicing8Table(IBMTable) == nil {
+		t.Fatal("IBMTable should have slicing-by-8 tables")
+	}
+}
+
+func TestHash16(t *testing.T) {
+	h := NewIBM()
+	h.Write([]byte("1234"))
+	h.Write([]byte("56789"))
+	assert.Equalf(t, h.Sum16(), uint16(0xbb3d), "Sum16()")
+	assert.Equalf(t, h.Sum([]byte{0xff}), []byte{0xff, 0xbb, 0x3d}, "Sum()")
+	assert.Equalf(t, h.Size(), 2, "Size()")
+	assert.Equalf(t, h.BlockSize(), 1, "BlockSize()")
+	h.Reset()
+	assert.Equalf(t, h.Sum16(), uint16(0), "Sum16() after Reset()")
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	data := make([]byte, 64*1024)
+	b.Run("slicing8", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			Update(0, IBMTable, data)
+		}
+	})
+	b.Run("simple", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			update(0, IBMTable, data)
+		}
+	})
+}
@@ -1,23 +1,26 @@
 package crc16
 
-import "io"
+import "hash"
 
 // Hash16 is the common interface implemented by all 16-bit hash functions.
 type Hash16 interface {
-	io.Writer
-
-	Reset()
+	hash.Hash
 
 	Sum16() uint16
 }
 
 type hash16 struct {
 	tab *Table
+	t8  *slicing8Table
 	crc uint16
 }
 
 func (h *hash16) Write(p []byte) (int, error) {
-	h.crc = Update(h.crc, h.tab, p)
+	if h.t8 != nil && len(p) >= slicing8Min {
+		h.crc = updateSlicing8(h.crc, h.t8, p)
+	} else {
+		h.crc = update(h.crc, h.tab, p)
+	}
 	return len(p), nil
 }
 
@@ -25,6 +28,18 @@ func (h *hash16) Reset() {
 	h.crc = 0
 }
 
+func (h *hash16) Size() int {
+	return Size
+}
+
+func (h *hash16) BlockSize() int {
+	return 1
+}
+
+func (h *hash16) Sum(in []byte) []byte {
+	return append(in, byte(h.crc>>8), byte(h.crc))
+}
+
 func (h *hash16) Sum16() uint16 {
 	return h.crc
 }
@@ -0,0 +1,93 @@
+package lha
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ExtendedHeaderHandler parses and serializes a type of extended header,
+// which is not supported by the package.
+type ExtendedHeaderHandler struct {
+	// Parse parses payload of the extended header to a value, which is
+	// stored in Header.Values.
+	Parse func(data []byte) (any, error)
+
+	// Serialize generates payload of the extended header from a value in
+	// Header.Values.
+	Serialize func(v any) ([]byte, error)
+}
+
+var (
+	customExHeadersMu sync.RWMutex
+	customExHeaders   = map[uint8]ExtendedHeaderHandler{}
+)
+
+// RegisterExtendedHeader registers a handler for a type of extended header.
+// Values of the type are read into Header.Values by Reader, and written from
+// Header.Values by Writer.  It panics if the type is already registered, or
+// is supported by the package.
+func RegisterExtendedHeader(t uint8, handler ExtendedHeaderHandler) {
+	if _, ok := exHeaderReaders[t]; ok {
+		panic(fmt.Sprintf("lha: extended header 0x%02x is supported by the package", t))
+	}
+	customExHeadersMu.Lock()
+	defer customExHeadersMu.Unlock()
+	if _, dup := customExHeaders[t]; dup {
+		panic(fmt.Sprintf("lha: extended header 0x%02x already registered", t))
+	}
+	customExHeaders[t] = handler
+}
+
+func customExHeader(t uint8) (ExtendedHeaderHandler, bool) {
+	customExHeadersMu.RLock()
+	defer customExHeadersMu.RUnlock()
+	handler, ok := customExHeaders[t]
+	return handler, ok
+}
+
+// readCustomExHeader parses a registered type of extended header into
+// h.Values.  An error of the handler is recorded in h.ValueErrors, so other
+// headers and files can be read.  It does nothing for unregistered types.
+func readCustomExHeader(h *Header, t uint8, d []byte) {
+	handler, ok := customExHeader(t)
+	if !ok {
+		return
+	}
+	v, err := handler.Parse(d)
+	if err != nil {
+		if h.ValueErrors == nil {
+			h.ValueErrors = map[uint8]error{}
+		}
+		h.ValueErrors[t] = fmt.Errorf("extended header 0x%02x: %w", t, err)
+		return
+	}
+	if h.Values == nil {
+		h.Values = map[uint8]any{}
+	}
+	h.Values[t] = v
+}
+
+// writeCustomExHeader generates payload of a registered type of extended
+// header from h.Values.  raw is the payload which was read, and it is kept
+// when it represents the current value, or it failed to be parsed.  It returns
+// false when the value is absent.
+func writeCustomExHeader(h *Header, handler ExtendedHeaderHandler, t uint8, raw []byte) ([]byte, bool, error) {
+	v, ok := h.Values[t]
+	if !ok {
+		if raw != nil && h.ValueErrors[t] != nil {
+			return raw, true, nil
+		}
+		return nil, false, nil
+	}
+	if raw != nil {
+		if w, err := handler.Parse(raw); err == nil && reflect.DeepEqual(w, v) {
+			return raw, true, nil
+		}
+	}
+	d, err := handler.Serialize(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("extended header 0x%02x: %w", t, err)
+	}
+	return d, true, nil
+}
@@ -0,0 +1,133 @@
+package lha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+type testMeta struct {
+	Version uint16
+	Label   string
+}
+
+var testMetaHandler = ExtendedHeaderHandler{
+	Parse: func(d []byte) (any, error) {
+		if len(d) < 2 {
+			return nil, errors.New("too short")
+		}
+		return testMeta{
+			Version: binary.LittleEndian.Uint16(d),
+			Label:   string(d[2:]),
+		}, nil
+	},
+	Serialize: func(v any) ([]byte, error) {
+		m, ok := v.(testMeta)
+		if !ok {
+			return nil, errors.New("not testMeta")
+		}
+		return append(binary.LittleEndian.AppendUint16(nil, m.Version), m.Label...), nil
+	},
+}
+
+func init() {
+	RegisterExtendedHeader(0xc0, testMetaHandler)
+}
+
+func testWriteHeader(t *testing.T, h *Header) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if _, err := w.CreateHeader(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestRegisterExtendedHeader(t *testing.T) {
+	b := testWriteHeader(t, &Header{
+		Name:   "meta",
+		Values: map[uint8]any{0xc0: testMeta{Version: 3, Label: "firmware"}},
+	})
+	headers, _ := testReadAll(t, b)
+	h := headers[0]
+	assert.Equal(t, map[uint8]any{0xc0: testMeta{Version: 3, Label: "firmware"}}, h.Values)
+	assert.Equal(t, ExtendedHeader{Type: 0xc0, Data: []byte("\x03\x00firmware")}, h.Extra[len(h.Extra)-1])
+
+	// update the value.
+	h.Values[0xc0] = testMeta{Version: 4, Label: "boot"}
+	headers, _ = testReadAll(t, testWriteHeader(t, h))
+	assert.Equal(t, map[uint8]any{0xc0: testMeta{Version: 4, Label: "boot"}}, headers[0].Values)
+
+	// remove the value.
+	h = headers[0]
+	delete(h.Values, 0xc0)
+	headers, _ = testReadAll(t, testWriteHeader(t, h))
+	assert.Equal(t, map[uint8]any(nil), headers[0].Values)
+	for _, x := range headers[0].Extra {
+		if x.Type == 0xc0 {
+			t.Fatal("removed extended header is written")
+		}
+	}
+}
+
+// testExtra returns payload of the extended header of t in h.
+func testExtra(h *Header, t uint8) []byte {
+	for _, x := range h.Extra {
+		if x.Type == t {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+func TestRegisterExtendedHeader_Errors(t *testing.T) {
+	// broken payload fails to read.
+	b := testWriteHeader(t, &Header{
+		Name:  "broken",
+		Extra: []ExtendedHeader{{Type: 0xc1, Data: []byte{0x01}}},
+	})
+	RegisterExtendedHeader(0xc1, testMetaHandler)
+	b = append(b[:len(b)-1], testWriteHeader(t, &Header{Name: "next"})...)
+	headers, _ := testReadAll(t, b)
+	assert.Equal(t, 2, len(headers))
+	if err := headers[0].ValueErrors[0xc1]; err == nil || err.Error() != "extended header 0xc1: too short" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, []byte{0x01}, testExtra(headers[0], 0xc1))
+	assert.Equal(t, "next", headers[1].Name)
+	// the broken payload is kept as is.
+	headers, _ = testReadAll(t, testWriteHeader(t, headers[0]))
+	assert.Equal(t, []byte{0x01}, testExtra(headers[0], 0xc1))
+	// the error is reported by Test.
+	rp, err := Test(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Status{StatusFailed, StatusOK}, testStatuses(rp))
+
+	// a value which can't be serialized fails to write.
+	w := NewWriter(io.Discard)
+	w.CreateHeader(&Header{Name: "bad", Values: map[uint8]any{0xc1: 123}})
+	if err := w.Close(); err == nil {
+		t.Fatal("bad value should fail to write")
+	}
+
+	for _, typ := range []uint8{0x01, 0xc0} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("registration of 0x%02x should panic", typ)
+				}
+			}()
+			RegisterExtendedHeader(typ, testMetaHandler)
+		}()
+	}
+}
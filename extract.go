@@ -0,0 +1,295 @@
+package lha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OverwritePolicy is a policy of Extract for existing files.
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways overwrites existing files.
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteSkip skips files which exist already.
+	OverwriteSkip
+	// OverwriteNewer overwrites existing files only when files in the archive
+	// are newer than them.
+	OverwriteNewer
+	// OverwriteRename extracts files with a suffix ".1", ".2" and so on, when
+	// they exist already.
+	OverwriteRename
+)
+
+var overwritePolicyNames = map[OverwritePolicy]string{
+	OverwriteAlways: "always",
+	OverwriteSkip:   "skip",
+	OverwriteNewer:  "newer",
+	OverwriteRename: "rename",
+}
+
+func (p OverwritePolicy) String() string {
+	if s, ok := overwritePolicyNames[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// ParseOverwritePolicy parses a name of OverwritePolicy: "always", "skip",
+// "newer" or "rename".
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	for p, name := range overwritePolicyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("lha: unknown overwrite policy: %q", s)
+}
+
+// ExtractOptions is options for Extract.
+type ExtractOptions struct {
+	// Observer is notified progress of extraction.
+	Observer Observer
+
+	// Include is patterns of path.Match for entries to be extracted.  They
+	// are matched with full slash separated paths in the archive, and an
+	// entry is extracted when its path or one of its parent directories
+	// matches.  All entries are extracted when it is empty.
+	Include []string
+	// Exclude is patterns of path.Match for entries to be skipped.  It is
+	// matched same as Include, and precedes Include.
+	Exclude []string
+
+	// StripComponents is number of leading path elements to be removed.
+	// Entries which have no more elements are skipped.
+	StripComponents int
+	// JunkPaths extracts all files into the top of the directory, without
+	// their directories.  Directory entries are skipped.
+	JunkPaths bool
+	// Rename returns a slash separated path to extract the entry of h, which
+	// is given name after StripComponents and JunkPaths applied.  The entry is
+	// skipped when it returns "".
+	Rename func(h *Header, name string) string
+
+	// Overwrite is a policy for existing files.
+	Overwrite OverwritePolicy
+
+	// ReaderOptions is options to read the archive.
+	ReaderOptions
+}
+
+// matchPath reports whether name or one of its parent directories matches one
+// of patterns.
+func matchPath(patterns []string, name string) (bool, error) {
+	for p := strings.TrimSuffix(name, "/"); p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pat := range patterns {
+			ok, err := path.Match(pat, p)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// target returns a slash separated path where the entry of h is extracted to.
+// It returns "" when the entry should be skipped.
+func (opts *ExtractOptions) target(h *Header) (string, error) {
+	name := h.slashPath()
+	if ok, err := matchPath(opts.Exclude, name); err != nil || ok {
+		return "", err
+	}
+	if len(opts.Include) > 0 {
+		if ok, err := matchPath(opts.Include, name); err != nil || !ok {
+			return "", err
+		}
+	}
+	isDir := strings.HasSuffix(name, "/")
+	if opts.StripComponents > 0 {
+		elems := strings.Split(strings.TrimSuffix(name, "/"), "/")
+		if len(elems) <= opts.StripComponents {
+			return "", nil
+		}
+		name = strings.Join(elems[opts.StripComponents:], "/")
+		if isDir {
+			name += "/"
+		}
+	}
+	if opts.JunkPaths {
+		if isDir {
+			return "", nil
+		}
+		name = path.Base(name)
+	}
+	if opts.Rename != nil {
+		name = opts.Rename(h, name)
+	}
+	return name, nil
+}
+
+// Extract extracts all files in an archive read from r, into dir.  It stops
+// when ctx is cancelled.  Files which paths escape from dir are rejected.
+func Extract(ctx context.Context, r io.Reader, dir string, opts *ExtractOptions) error {
+	t, err := NewDirTarget(dir)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	return ExtractTo(ctx, r, t, opts)
+}
+
+// ExtractTo extracts all files in an archive read from r, into target.  It
+// stops when ctx is cancelled.  Files and symbolic links which paths escape
+// from target are rejected.
+func ExtractTo(ctx context.Context, r io.Reader, target ExtractTarget, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	lr := NewReaderWithOptions(r, &opts.ReaderOptions)
+	if opts.Observer != nil {
+		lr.SetObserver(opts.Observer)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h, err := lr.NextHeader()
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			return nil
+		}
+		name, err := opts.target(h)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if err := extractEntry(ctx, lr, h, target, name, opts.Overwrite); err != nil {
+			return fmt.Errorf("%s: %w", h.Path(), err)
+		}
+	}
+}
+
+// isLocalPath reports whether slash separated name is local to the target.
+func isLocalPath(name string) bool {
+	return fs.ValidPath(name) && filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// checkParents rejects name when one of its parents is a symbolic link,
+// otherwise files may be written outside of the target through chained links.
+// It checks nothing when target doesn't implement Lstat.
+func checkParents(target ExtractTarget, name string) error {
+	lt, ok := target.(lstatTarget)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] != '/' {
+			continue
+		}
+		fi, err := lt.Lstat(name[:i])
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("unsafe path: %s is a symbolic link", name[:i])
+		}
+	}
+	return nil
+}
+
+func extractEntry(ctx context.Context, r *Reader, h *Header, target ExtractTarget, name string, policy OverwritePolicy) error {
+	name = path.Clean(name)
+	if !isLocalPath(name) {
+		return fmt.Errorf("unsafe path: %s", h.Path())
+	}
+	if err := checkParents(target, name); err != nil {
+		return err
+	}
+	if h.IsDir() {
+		if err := target.Mkdir(name, h); err != nil {
+			return err
+		}
+		return target.SetMetadata(name, h)
+	}
+	name, err := resolveOverwrite(target, name, h, policy)
+	if err != nil || name == "" {
+		return err
+	}
+	if link := h.Linkname(); link != "" {
+		// reject links which escape from the target, otherwise following
+		// files may be written through them.
+		if path.IsAbs(link) || !isLocalPath(path.Join(path.Dir(name), link)) {
+			return fmt.Errorf("unsafe link: %s", link)
+		}
+		return target.Symlink(name, link, h)
+	}
+	w, err := target.Create(name, h)
+	if err != nil {
+		return err
+	}
+	_, err = r.DecodeContext(ctx, w)
+	if err2 := w.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		if rt, ok := target.(removeTarget); ok {
+			rt.Remove(name)
+		}
+		return err
+	}
+	return target.SetMetadata(name, h)
+}
+
+// resolveOverwrite returns a name to extract the entry of h to, by policy.  It
+// returns "" when the entry should be skipped.
+func resolveOverwrite(target ExtractTarget, name string, h *Header, policy OverwritePolicy) (string, error) {
+	if policy == OverwriteAlways {
+		return name, nil
+	}
+	lt, ok := target.(lstatTarget)
+	if !ok {
+		return "", fmt.Errorf("lha: overwrite policy %s is not supported by %T", policy, target)
+	}
+	fi, err := lt.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch policy {
+	case OverwriteSkip:
+		return "", nil
+	case OverwriteNewer:
+		if compareModTime(h, fi.ModTime()) <= 0 {
+			return "", nil
+		}
+	case OverwriteRename:
+		for i := 1; ; i++ {
+			s := name + "." + strconv.Itoa(i)
+			if _, err := lt.Lstat(s); errors.Is(err, fs.ErrNotExist) {
+				return s, nil
+			} else if err != nil {
+				return "", err
+			}
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,281 @@
+package lha
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+type testEvent struct {
+	Kind    string
+	Name    string
+	In, Out int64
+	Err     error
+}
+
+// testObserver records events, and calls onProgress if it is set.
+type testObserver struct {
+	events     []testEvent
+	onProgress func()
+}
+
+func (o *testObserver) StartEntry(h *Header) {
+	o.events = append(o.events, testEvent{Kind: "start", Name: h.Name})
+}
+
+func (o *testObserver) Progress(h *Header, in, out int64) {
+	// record only the last progress for each entry.
+	if last := &o.events[len(o.events)-1]; last.Kind == "progress" {
+		last.In, last.Out = in, out
+	} else {
+		o.events = append(o.events, testEvent{Kind: "progress", Name: h.Name, In: in, Out: out})
+	}
+	if o.onProgress != nil {
+		o.onProgress()
+	}
+}
+
+func (o *testObserver) EndEntry(h *Header, err error) {
+	o.events = append(o.events, testEvent{Kind: "end", Name: h.Name, Err: err})
+}
+
+type testFile struct {
+	name   string
+	method string
+	data   string
+}
+
+func testBuildArchive(t testing.TB, files ...testFile) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, f := range files {
+		dir, name := filepath.Split(f.name)
+		fw, err := w.CreateHeader(&Header{Method: f.method, Dir: dir, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	big := strings.Repeat("Hello LHA. ", 10000)
+	b := testBuildArchive(t,
+		testFile{"sub/", "-lhd-", ""},
+		testFile{"sub/a.txt", "-lh0-", "Hello LHA\n"},
+		testFile{"b.txt", "-lh5-", big},
+	)
+	headers, _ := testReadAll(t, b)
+	dir := t.TempDir()
+	obs := &testObserver{}
+	if err := Extract(context.Background(), bytes.NewReader(b), dir, &ExtractOptions{Observer: obs}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "sub", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello LHA\n", string(got))
+	got, err = os.ReadFile(filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, big, string(got))
+	assert.Equal(t, []testEvent{
+		{Kind: "start", Name: "a.txt"},
+		{Kind: "progress", Name: "a.txt", In: 10, Out: 10},
+		{Kind: "end", Name: "a.txt"},
+		{Kind: "start", Name: "b.txt"},
+		{Kind: "progress", Name: "b.txt", In: int64(headers[2].PackedSize), Out: int64(len(big))},
+		{Kind: "end", Name: "b.txt"},
+	}, obs.events)
+}
+
+func TestExtract_Cancel(t *testing.T) {
+	b := testBuildArchive(t,
+		testFile{"a.txt", "-lh5-", strings.Repeat("Hello LHA. ", 100000)},
+	)
+	t.Run("before", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := Extract(ctx, bytes.NewReader(b), t.TempDir(), nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("while", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		dir := t.TempDir()
+		obs := &testObserver{onProgress: cancel}
+		err := Extract(ctx, bytes.NewReader(b), dir, &ExtractOptions{Observer: obs})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		last := obs.events[len(obs.events)-1]
+		assert.Equal(t, "end", last.Kind)
+		if !errors.Is(last.Err, context.Canceled) {
+			t.Fatalf("unexpected error of entry: %v", last.Err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+			t.Fatalf("cancelled file should be removed: %v", err)
+		}
+	})
+}
+
+func TestExtract_UnsafePath(t *testing.T) {
+	b := testBuildArchive(t, testFile{"../evil.txt", "-lh0-", "evil"})
+	dir := t.TempDir()
+	err := Extract(context.Background(), bytes.NewReader(b), filepath.Join(dir, "out"), nil)
+	if err == nil || !strings.Contains(err.Error(), "unsafe path") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+		t.Fatalf("unsafe file should not be extracted: %v", err)
+	}
+}
+
+// testExtractedFiles returns all files under dir with their contents.
+func testExtractedFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtract_Options(t *testing.T) {
+	b := testBuildArchive(t,
+		testFile{"top/", "-lhd-", ""},
+		testFile{"top/a.txt", "-lh0-", "A"},
+		testFile{"top/sub/b.txt", "-lh5-", "B"},
+		testFile{"top/sub/c.go", "-lh5-", "C"},
+		testFile{"top/tmp/d.txt", "-lh0-", "D"},
+		testFile{"e.txt", "-lh0-", "E"},
+	)
+	for _, tc := range []struct {
+		name string
+		opts ExtractOptions
+		want map[string]string
+	}{
+		{"include", ExtractOptions{Include: []string{"top/sub", "*.txt"}}, map[string]string{
+			"top/sub/b.txt": "B", "top/sub/c.go": "C", "e.txt": "E",
+		}},
+		{"exclude", ExtractOptions{Exclude: []string{"top/tmp", "*/*/*.go"}}, map[string]string{
+			"top/a.txt": "A", "top/sub/b.txt": "B", "e.txt": "E",
+		}},
+		{"strip", ExtractOptions{StripComponents: 1}, map[string]string{
+			"a.txt": "A", "sub/b.txt": "B", "sub/c.go": "C", "tmp/d.txt": "D",
+		}},
+		{"junk", ExtractOptions{JunkPaths: true, Exclude: []string{"e.txt"}}, map[string]string{
+			"a.txt": "A", "b.txt": "B", "c.go": "C", "d.txt": "D",
+		}},
+		{"rename", ExtractOptions{
+			Include: []string{"top/sub"},
+			Rename: func(h *Header, name string) string {
+				if h.Name == "c.go" {
+					return ""
+				}
+				return "renamed/" + name
+			},
+		}, map[string]string{
+			"renamed/top/sub/b.txt": "B",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := Extract(context.Background(), bytes.NewReader(b), dir, &tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, testExtractedFiles(t, dir))
+		})
+	}
+}
+
+func TestExtract_Overwrite(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, name := range []string{"old.txt", "new.txt"} {
+		fw, err := w.CreateHeader(&Header{Method: "-lh0-", Name: name, Time: mtime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, "archived")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		policy OverwritePolicy
+		want   map[string]string
+	}{
+		{OverwriteAlways, map[string]string{"old.txt": "archived", "new.txt": "archived"}},
+		{OverwriteSkip, map[string]string{"old.txt": "existing", "new.txt": "existing"}},
+		{OverwriteNewer, map[string]string{"old.txt": "archived", "new.txt": "existing"}},
+		{OverwriteRename, map[string]string{
+			"old.txt": "existing", "new.txt": "existing",
+			"old.txt.1": "archived", "new.txt.1": "archived",
+		}},
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			for name, d := range map[string]time.Duration{"old.txt": -time.Hour, "new.txt": time.Hour} {
+				p := filepath.Join(dir, name)
+				if err := os.WriteFile(p, []byte("existing"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(p, mtime.Add(d), mtime.Add(d)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := Extract(context.Background(), bytes.NewReader(buf.Bytes()), dir, &ExtractOptions{Overwrite: tc.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, testExtractedFiles(t, dir))
+		})
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	for _, p := range []OverwritePolicy{OverwriteAlways, OverwriteSkip, OverwriteNewer, OverwriteRename} {
+		got, err := ParseOverwritePolicy(p.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, p, got)
+	}
+	if _, err := ParseOverwritePolicy("unknown"); err == nil {
+		t.Fatal("unknown policy should fail")
+	}
+}
@@ -0,0 +1,166 @@
+package lha
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/lzhuff"
+)
+
+var errIndexMismatch = errors.New("lha: index doesn't match the file")
+
+// File is a file in an archive, which can be read randomly.
+type File struct {
+	Header
+
+	ra           io.ReaderAt
+	headerOffset int64
+	bodyOffset   int64
+}
+
+// ReadFiles reads all headers in an archive from r, which has size bytes, to
+// access files randomly.  It reads headers only, and skips packed data of
+// files without reading them.
+func ReadFiles(r io.ReaderAt, size int64) ([]*File, error) {
+	return ReadFilesWithOptions(r, size, nil)
+}
+
+// ReadFilesWithOptions is ReadFiles which reads headers with opts.
+func ReadFilesWithOptions(r io.ReaderAt, size int64, opts *ReaderOptions) ([]*File, error) {
+	var files []*File
+	var lr *Reader
+	for off := int64(0); ; {
+		sr := io.NewSectionReader(r, off, size-off)
+		if lr == nil {
+			lr = NewReaderWithOptions(sr, opts)
+		} else {
+			lr.Reset(sr)
+		}
+		h, err := lr.NextHeader()
+		if err != nil {
+			return nil, err
+		}
+		if h == nil {
+			return files, nil
+		}
+		f := &File{
+			Header:       *h,
+			ra:           r,
+			headerOffset: off + lr.headerOffset,
+			bodyOffset:   off + lr.bodyOffset,
+		}
+		if f.bodySize() > uint64(size-f.bodyOffset) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		files = append(files, f)
+		off = f.bodyOffset + int64(f.bodySize())
+	}
+}
+
+// HeaderOffset returns offset of the header in the archive.
+func (f *File) HeaderOffset() int64 {
+	return f.headerOffset
+}
+
+// DataOffset returns offset of the packed data in the archive.
+func (f *File) DataOffset() int64 {
+	return f.bodyOffset
+}
+
+// OpenRaw returns a reader which provides packed data of the file as is.
+func (f *File) OpenRaw() (io.Reader, error) {
+	return io.NewSectionReader(f.ra, f.bodyOffset, int64(f.bodySize())), nil
+}
+
+// BuildIndex decodes the file once, and builds an index for OpenReaderAt,
+// which has a checkpoint for each interval bytes of decoded data.  The index
+// can be persisted with its MarshalBinary.  It returns nil for stored files,
+// which don't need an index.
+func (f *File) BuildIndex(interval int64) (*lzhuff.Index, error) {
+	if f.Method == "-lh0-" || f.IsDir() {
+		return nil, nil
+	}
+	m, ok := staticMethods[f.Method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported method to index: %s", f.Method)
+	}
+	raw, _ := f.OpenRaw()
+	return lzhuff.BuildIndex(raw, m.dictBits, m.pbits, m.pnum, int64(f.OriginalSize), interval)
+}
+
+// OpenReaderAt returns a reader which reads decoded data of the file
+// randomly, with an index built by BuildIndex.  idx can be nil for stored
+// files.  The returned reader doesn't verify CRC.
+func (f *File) OpenReaderAt(idx *lzhuff.Index) (*io.SectionReader, error) {
+	raw := io.NewSectionReader(f.ra, f.bodyOffset, int64(f.bodySize()))
+	size := int64(f.OriginalSize)
+	if f.Method == "-lh0-" || f.IsDir() {
+		return io.NewSectionReader(raw, 0, size), nil
+	}
+	m, ok := staticMethods[f.Method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported method to index: %s", f.Method)
+	}
+	if idx == nil || idx.DictBits != m.dictBits || idx.PBits != m.pbits || idx.PNum != m.pnum || idx.Size != size {
+		return nil, errIndexMismatch
+	}
+	return io.NewSectionReader(lzhuff.NewReaderAt(raw, idx), 0, size), nil
+}
+
+// Open returns a reader which provides decoded data of the file.  Read of the
+// reader returns an error when CRC of the data is mismatched.
+func (f *File) Open() (io.Reader, error) {
+	dcomp := decompressor(f.Method)
+	if dcomp == nil {
+		return nil, fmt.Errorf("unsupported method: %s", f.Method)
+	}
+	raw, _ := f.OpenRaw()
+	size := int64(f.OriginalSize)
+	return &checksumReader{
+		rd:     dcomp(raw, size),
+		hash:   crc16.NewIBM(),
+		remain: size,
+		crc:    f.CRC,
+	}, nil
+}
+
+// checksumReader verifies size and CRC of decoded data at the end.
+type checksumReader struct {
+	rd     io.Reader
+	hash   crc16.Hash16
+	remain int64
+	crc    uint16
+	err    error
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remain <= 0 {
+		r.err = io.EOF
+		if r.hash.Sum16() != r.crc {
+			r.err = errBodyCRCMismatch
+		}
+		return 0, r.err
+	}
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err := r.rd.Read(p)
+	r.hash.Write(p[:n])
+	r.remain -= int64(n)
+	if err == io.EOF {
+		if r.remain > 0 {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
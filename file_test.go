@@ -0,0 +1,199 @@
+package lha
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testReadFiles(t *testing.T, b []byte) []*File {
+	t.Helper()
+	files, err := ReadFiles(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func testOpen(t *testing.T, f *File) string {
+	t.Helper()
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFile_Open(t *testing.T) {
+	big := strings.Repeat("Hello LHA. ", 10000)
+	b := testBuildArchive(t,
+		testFile{"a.txt", "-lh0-", "Hello LHA\n"},
+		testFile{"b.txt", "-lh5-", big},
+	)
+	files := testReadFiles(t, b)
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, int64(0), files[0].HeaderOffset())
+	assert.Equal(t, "Hello LHA\n", testOpen(t, files[0]))
+	assert.Equal(t, big, testOpen(t, files[1]))
+
+	raw, err := files[0].OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := io.ReadAll(raw)
+	assert.Equal(t, "Hello LHA\n", string(d))
+	off := files[0].DataOffset()
+	assert.Equal(t, int64(files[0].Size), off)
+	assert.Equal(t, off+10, files[1].HeaderOffset())
+
+	// broken data is detected by CRC.
+	b[off] ^= 0xff
+	r, _ := testReadFiles(t, b)[0].Open()
+	if _, err := io.ReadAll(r); err != errBodyCRCMismatch {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// countReaderAt counts bytes read from ReaderAt.
+type countReaderAt struct {
+	ra io.ReaderAt
+	n  int64
+}
+
+func (r *countReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ra.ReadAt(p, off)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestReadFiles_SkipBodies(t *testing.T) {
+	big := strings.Repeat("x", 1<<20)
+	b := testBuildArchive(t,
+		testFile{"a.txt", "-lh0-", big},
+		testFile{"b.txt", "-lh0-", big},
+		testFile{"c.txt", "-lh0-", "Hello LHA\n"},
+	)
+	cr := &countReaderAt{ra: bytes.NewReader(b)}
+	files, err := ReadFiles(cr, int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(files))
+	assert.Equal(t, "Hello LHA\n", testOpen(t, files[2]))
+	if cr.n >= 1<<20 {
+		t.Fatalf("packed data is read: %d bytes", cr.n)
+	}
+
+	// truncated archives are detected without reading bodies.
+	_, err = ReadFiles(bytes.NewReader(b), files[1].DataOffset()+10)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWriter_Copy(t *testing.T) {
+	big := strings.Repeat("Hello LHA. ", 10000)
+	src := testBuildArchive(t,
+		testFile{"a.txt", "-lh0-", "Hello LHA\n"},
+		testFile{"b.txt", "-lh5-", big},
+		testFile{"c.txt", "-lh0-", "dropped"},
+	)
+	// append a level 0 entry, which is copied in level 0.
+	src = append(src[:len(src)-1], testArchive(testLv0Entry("-lh0-", "d.txt", []byte("level 0")))...)
+	files := testReadFiles(t, src)
+
+	// reorder, rename and drop entries.
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	files[3].Name = "renamed.txt"
+	for _, f := range []*File{files[3], files[1], files[0]} {
+		h := f.Header
+		if err := w.Copy(f); err != nil {
+			t.Fatal(err)
+		}
+		// the header of the source file is not modified.
+		assert.Equal(t, h, f.Header)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := testReadFiles(t, b.Bytes())
+	assert.Equal(t, 3, len(copied))
+	assert.Equal(t, "renamed.txt", copied[0].Name)
+	assert.Equal(t, uint8(0), copied[0].Level)
+	assert.Equal(t, "level 0", testOpen(t, copied[0]))
+	assert.Equal(t, uint8(2), copied[1].Level)
+	assert.Equal(t, "b.txt", copied[1].Name)
+	assert.Equal(t, files[1].PackedSize, copied[1].PackedSize)
+	assert.Equal(t, big, testOpen(t, copied[1]))
+	assert.Equal(t, "Hello LHA\n", testOpen(t, copied[2]))
+}
+
+func TestWriter_CreateRawSizeMismatch(t *testing.T) {
+	w := NewWriter(io.Discard)
+	fw, err := w.CreateRaw(&Header{Method: "-lh0-", Name: "a", PackedSize: 4, OriginalSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte("abcde")); err != errRawSizeMismatch {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fw.Write([]byte("abc"))
+	if err := w.Close(); err != errRawSizeMismatch {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFile_OpenReaderAt(t *testing.T) {
+	var text strings.Builder
+	for i := 0; text.Len() < 1<<20; i++ {
+		fmt.Fprintf(&text, "line %d: Hello LHA.\n", i)
+	}
+	data := text.String()
+	b := testBuildArchive(t,
+		testFile{"stored.txt", "-lh0-", data[:1000]},
+		testFile{"packed.txt", "-lh6-", data},
+	)
+	files := testReadFiles(t, b)
+
+	// stored files don't need an index.
+	idx, err := files[0].BuildIndex(1 << 16)
+	if err != nil || idx != nil {
+		t.Fatalf("unexpected index for stored file: %v %v", idx, err)
+	}
+	sr, err := files[0].OpenReaderAt(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 10)
+	sr.ReadAt(p, 500)
+	assert.Equal(t, data[500:510], string(p))
+
+	idx, err = files[1].BuildIndex(1 << 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files[1].OpenReaderAt(nil); err != errIndexMismatch {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sr, err = files[1].OpenReaderAt(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range []int64{700000, 12345, 0, int64(len(data)) - 5} {
+		if _, err := sr.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		n, _ := io.ReadFull(sr, p)
+		assert.Equal(t, data[off:off+int64(n)], string(p[:n]))
+	}
+}
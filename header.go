@@ -1,8 +1,16 @@
 package lha
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io/fs"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -20,22 +28,88 @@ type Header struct {
 	OSID         uint8
 
 	Name string
+	// Comment is comment of the file.  It is stored after NUL in the name of
+	// level 0 and 1 headers, or in extended header 0x3f.
+	Comment string
 
 	HeaderCRC    *uint16
 	ExtendType   ExtendType
 	MinorVersion uint8
 	Dir          string
 
+	// TimeSource is a source of Time: DOS timestamp for level 0 and 1
+	// headers, or UNIX time for level 2 and 3 headers.  ModTime returns more
+	// precise time in extensions.
+	TimeSource TimeSource
+
 	ExtendedHeaderSize uint64
+	// Extra is all extended headers in appearance order, including types
+	// which are parsed into other fields.
+	Extra []ExtendedHeader
+	// Values is parsed values of extended headers, which types are
+	// registered by RegisterExtendedHeader.
+	Values map[uint8]any
+	// ValueErrors is errors of registered types of extended headers, which
+	// failed to be parsed.  Their payloads are kept in Extra as is.
+	ValueErrors map[uint8]error
+
+	DOS     HeaderDOS
+	UNIX    HeaderUNIX
+	Windows HeaderWindows
+}
+
+// bodySize returns size of packed data.  PackedSize of level 1 header
+// includes size of extended headers.
+func (h *Header) bodySize() uint64 {
+	if h.Level == 1 && h.PackedSize >= h.ExtendedHeaderSize {
+		return h.PackedSize - h.ExtendedHeaderSize
+	}
+	return h.PackedSize
+}
 
-	DOS  HeaderDOS
-	UNIX HeaderUNIX
+// ExtendedHeader is a raw extended header.
+type ExtendedHeader struct {
+	Type uint8
+	Data []byte
 }
 
 // HeaderDOS is exntended header for DOS.
 type HeaderDOS struct {
 	Attr uint16
-	Time uint64
+	// Time is DOS timestamp in the header of level 0 or 1, which is
+	// converted in the location of the reader.
+	Time time.Time
+	// RawTime is raw value of DOS timestamp.
+	RawTime uint32
+}
+
+// TimeSource is a source of Header.Time, or time returned by Header.ModTime.
+type TimeSource uint8
+
+const (
+	// TimeSourceHeader is UNIX time in the header of level 2 or 3.
+	TimeSourceHeader TimeSource = iota
+	// TimeSourceDOS is DOS timestamp in the header of level 0 or 1.
+	TimeSourceDOS
+	// TimeSourceUNIX is UNIX time in UNIX extension of level 0 header, or
+	// extended header 0x54.
+	TimeSourceUNIX
+	// TimeSourceWindows is modification time in extended header 0x41.
+	TimeSourceWindows
+)
+
+var timeSourceNames = map[TimeSource]string{
+	TimeSourceHeader:  "header",
+	TimeSourceDOS:     "dos",
+	TimeSourceUNIX:    "unix",
+	TimeSourceWindows: "windows",
+}
+
+func (ts TimeSource) String() string {
+	if s, ok := timeSourceNames[ts]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(ts))
 }
 
 // HeaderUNIX is exntended header for UNIX.
@@ -48,6 +122,171 @@ type HeaderUNIX struct {
 	Time  time.Time
 }
 
+// HeaderWindows is extended header for Windows.
+type HeaderWindows struct {
+	CreationTime     time.Time
+	ModificationTime time.Time
+	AccessTime       time.Time
+}
+
+// Path returns full path of the file, which joins Dir and Name.
+func (h *Header) Path() string {
+	return filepath.Join(h.Dir, h.Name)
+}
+
+// ModTime returns the most precise modification time of the file, and its
+// source.  For level 0 and 1 headers, UNIX or Windows time in extensions
+// precedes DOS timestamp, because it doesn't depend on time zones.
+func (h *Header) ModTime() (time.Time, TimeSource) {
+	if h.TimeSource == TimeSourceDOS {
+		if !h.UNIX.Time.IsZero() {
+			return h.UNIX.Time, TimeSourceUNIX
+		}
+		if !h.Windows.ModificationTime.IsZero() {
+			return h.Windows.ModificationTime, TimeSourceWindows
+		}
+	}
+	return h.Time, h.TimeSource
+}
+
+// compareModTime compares ModTime of h with t in seconds, within resolution
+// of the source.  It returns 1 when h is newer, -1 when t is newer, or 0.
+func compareModTime(h *Header, t time.Time) int {
+	mt, src := h.ModTime()
+	hs, ts := mt.Unix(), t.Unix()
+	var res int64
+	if src == TimeSourceDOS {
+		// DOS timestamp has only 2 seconds resolution.
+		res = 1
+	}
+	switch {
+	case hs > ts:
+		return 1
+	case ts > hs+res:
+		return -1
+	}
+	return 0
+}
+
+// inLocation converts times in h, except zero ones, to loc.
+func (h *Header) inLocation(loc *time.Location) {
+	for _, t := range []*time.Time{
+		&h.Time,
+		&h.UNIX.Time,
+		&h.Windows.CreationTime,
+		&h.Windows.ModificationTime,
+		&h.Windows.AccessTime,
+	} {
+		if !t.IsZero() {
+			*t = t.In(loc)
+		}
+	}
+}
+
+// IsDir reports whether the header describes a directory.  A symbolic link
+// is stored with -lhd- too, but it isn't a directory.
+func (h *Header) IsDir() bool {
+	return h.Method == "-lhd-" && h.UNIX.Perm&0170000 != 0120000
+}
+
+// Mode returns file mode of the file.  It is derived from UNIX permission
+// when available, otherwise from method and DOS attributes.
+func (h *Header) Mode() fs.FileMode {
+	if h.UNIX.Perm != 0 {
+		return unixMode(h.UNIX.Perm)
+	}
+	mode := fs.FileMode(0644)
+	if h.IsDir() {
+		mode = fs.ModeDir | 0755
+	}
+	if h.Attribute&0x01 != 0 {
+		// read only
+		mode &^= 0222
+	}
+	return mode
+}
+
+func unixMode(perm uint16) fs.FileMode {
+	mode := fs.FileMode(perm & 0777)
+	switch perm & 0170000 {
+	case 0040000:
+		mode |= fs.ModeDir
+	case 0120000:
+		mode |= fs.ModeSymlink
+	}
+	if perm&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if perm&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if perm&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// unixPerm converts mode to UNIX permission, which is the reverse of
+// unixMode.
+func unixPerm(mode fs.FileMode) uint16 {
+	perm := uint16(mode.Perm())
+	switch {
+	case mode.IsDir():
+		perm |= 0040000
+	case mode&fs.ModeSymlink != 0:
+		perm |= 0120000
+	case mode.IsRegular():
+		perm |= 0100000
+	}
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
+
+// Linkname returns target of symbolic link.  It is stored after "|" in the
+// name.
+func (h *Header) Linkname() string {
+	if h.Mode()&fs.ModeSymlink == 0 {
+		return ""
+	}
+	_, link, _ := strings.Cut(h.Name, "|")
+	return link
+}
+
+// FileInfo returns an fs.FileInfo for the file.
+func (h *Header) FileInfo() fs.FileInfo {
+	return headerFileInfo{h}
+}
+
+type headerFileInfo struct {
+	h *Header
+}
+
+func (fi headerFileInfo) Name() string {
+	name := fi.h.Name
+	if fi.h.Mode()&fs.ModeSymlink != 0 {
+		name, _, _ = strings.Cut(name, "|")
+	}
+	if name == "" {
+		// directory entry, which has only Dir.
+		name = path.Base(filepath.ToSlash(fi.h.Dir))
+	}
+	return name
+}
+
+func (fi headerFileInfo) Size() int64        { return int64(fi.h.OriginalSize) }
+func (fi headerFileInfo) Mode() fs.FileMode  { return fi.h.Mode() }
+func (fi headerFileInfo) ModTime() time.Time { return fi.h.Time }
+func (fi headerFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi headerFileInfo) Sys() any           { return fi.h }
+
 // ExtendType is type of exntend part.
 type ExtendType uint8
 
@@ -78,7 +317,7 @@ const (
 	ExtendRUNSER ExtendType = 'R'
 )
 
-type headerReader func(r *Reader) (*Header, error)
+type headerReader func(r *Reader, h *Header) error
 
 var headerReaders = map[byte]headerReader{
 	0: readHeaderLv0,
@@ -87,36 +326,40 @@ var headerReaders = map[byte]headerReader{
 	3: readHeaderLv3,
 }
 
-func readHeaderLv0(r *Reader) (*Header, error) {
-	h := new(Header)
+func readHeaderLv0(r *Reader, h *Header) error {
 	headerSize, _ := r.readUint8()
 	h.Size = uint16(headerSize)
 	h.Sum, _ = r.readUint8()
-	// FIXME: verify check sum
-	h.Method, _ = r.readStringN(5)
+	r.sum = 0
+	h.Method, _ = r.readMethod()
 	packedSize, _ := r.readUint32()
 	h.PackedSize = uint64(packedSize)
 	originalSize, _ := r.readUint32()
 	h.OriginalSize = uint64(originalSize)
-	dt, _ := r.readUint32()
-	h.Time = fromDOSTimestamp(dt)
+	h.DOS.RawTime, _ = r.readUint32()
+	h.DOS.Time = fromDOSTimestamp(h.DOS.RawTime, r.location)
+	h.Time, h.TimeSource = h.DOS.Time, TimeSourceDOS
 	h.Attribute, _ = r.readUint8()
 	h.Level, _ = r.readUint8()
 	nameLen, _ := r.readUint8()
-	h.Name, _ = r.readStringN(int(nameLen))
+	name, _ := r.readStringN(int(nameLen))
+	h.Name, h.Comment = splitComment(name)
+	h.Dir, h.Name = splitLv0Path(h.Name)
 
 	extendSize := int(headerSize) + 2 - int(nameLen) - 24
 	if extendSize < 0 {
 		if extendSize == -2 {
 			h.HeaderCRC = nil
-			return h, nil
+			r.headerSum = r.sum
+			return r.err
 		}
-		return nil, errors.New("unknown header")
+		return errors.New("unknown header")
 	}
 
 	*(*uint16)(&h.CRC), _ = r.readUint16()
 	if extendSize == 0 {
-		return h, nil
+		r.headerSum = r.sum
+		return r.err
 	}
 
 	extendType, _ := r.readUint8()
@@ -135,53 +378,69 @@ func readHeaderLv0(r *Reader) (*Header, error) {
 		}
 	}
 
-	if remain := int(h.Size) - int(r.cnt); remain > 0 {
+	if remain := int(h.Size) + 2 - int(r.cnt); remain > 0 {
 		r.skip(remain)
 	}
 	if r.err != nil {
-		return nil, r.err
+		return r.err
+	}
+	r.headerSum = r.sum
+	return nil
+}
+
+// splitLv0Path splits a path in level 0 header into directory and name at
+// the last "/".  "\\" is not a separator, because it may be the second byte
+// of a Shift_JIS character.  A target of a symbolic link is kept in name.
+func splitLv0Path(p string) (dir, name string) {
+	end := len(p)
+	if i := strings.IndexByte(p, '|'); i >= 0 {
+		end = i
+	}
+	i := strings.LastIndexByte(p[:end], '/')
+	if i < 0 {
+		return "", p
 	}
-	return h, nil
+	return filepath.FromSlash(p[:i+1]), p[i+1:]
 }
 
-func readHeaderLv1(r *Reader) (*Header, error) {
-	h := new(Header)
+func readHeaderLv1(r *Reader, h *Header) error {
 	headerSize, _ := r.readUint8()
 	h.Size = uint16(headerSize)
 	h.Sum, _ = r.readUint8()
-	// FIXME: verify check sum
-	h.Method, _ = r.readStringN(5)
+	r.sum = 0
+	h.Method, _ = r.readMethod()
 	packedSize, _ := r.readUint32()
 	h.PackedSize = uint64(packedSize)
 	originalSize, _ := r.readUint32()
 	h.OriginalSize = uint64(originalSize)
-	dt, _ := r.readUint32()
-	h.Time = fromDOSTimestamp(dt)
+	h.DOS.RawTime, _ = r.readUint32()
+	h.DOS.Time = fromDOSTimestamp(h.DOS.RawTime, r.location)
+	h.Time, h.TimeSource = h.DOS.Time, TimeSourceDOS
 	h.Attribute, _ = r.readUint8() // 0x20 fixed
 	h.Level, _ = r.readUint8()
 	nameLen, _ := r.readUint8()
-	h.Name, _ = r.readStringN(int(nameLen))
+	name, _ := r.readStringN(int(nameLen))
+	h.Name, h.Comment = splitComment(name)
 	*(*uint16)(&h.CRC), _ = r.readUint16()
 	h.OSID, _ = r.readUint8()
-	// FIXME: consider 64bit length.
 	if remain := int(h.Size) - int(nameLen) - 25; remain > 0 {
 		r.skip(remain)
 	}
 	nextSize, _ := r.readUint16()
-	readAllExtendedHeaders(r, h, nextSize)
+	r.headerSum = r.sum
+	readAllExtendedHeaders(r, h, int(nextSize), 2)
 	if r.err != nil {
-		return nil, r.err
+		return r.err
 	}
-	return h, nil
+	return nil
 }
 
-func readHeaderLv2(r *Reader) (*Header, error) {
+func readHeaderLv2(r *Reader, h *Header) error {
 	if r.err != nil {
-		return nil, r.err
+		return r.err
 	}
-	h := new(Header)
 	h.Size, _ = r.readUint16()
-	h.Method, _ = r.readStringN(5)
+	h.Method, _ = r.readMethod()
 	packedSize, _ := r.readUint32()
 	h.PackedSize = uint64(packedSize)
 	originalSize, _ := r.readUint32()
@@ -192,21 +451,19 @@ func readHeaderLv2(r *Reader) (*Header, error) {
 	*(*uint16)(&h.CRC), _ = r.readUint16()
 	h.OSID, _ = r.readUint8()
 	nextSize, _ := r.readUint16()
-	readAllExtendedHeaders(r, h, nextSize)
-	// FIXME: consider 64bit length.
+	readAllExtendedHeaders(r, h, int(nextSize), 2)
 	if remain := int(h.Size) - int(r.cnt); remain > 0 {
 		r.skip(remain)
 	}
 	if r.err != nil {
-		return nil, r.err
+		return r.err
 	}
-	return h, nil
+	return nil
 }
 
-func readHeaderLv3(r *Reader) (*Header, error) {
-	h := new(Header)
-	_, _ = r.readUint16()
-	h.Method, _ = r.readStringN(5)
+func readHeaderLv3(r *Reader, h *Header) error {
+	h.Size, _ = r.readUint16()
+	h.Method, _ = r.readMethod()
 	packedSize, _ := r.readUint32()
 	h.PackedSize = uint64(packedSize)
 	originalSize, _ := r.readUint32()
@@ -218,23 +475,23 @@ func readHeaderLv3(r *Reader) (*Header, error) {
 	h.OSID, _ = r.readUint8()
 	headerSize, _ := r.readUint32()
 	nextSize, _ := r.readUint32()
-	readAllExtendedHeaders(r, h, uint16(nextSize))
-	// FIXME: consider 64bit length.
-	if remain := int(headerSize) - int(r.cnt); remain >= 0 {
-		r.skip(remain)
+	readAllExtendedHeaders(r, h, int(nextSize), 4)
+	if remain := int64(headerSize) - int64(r.cnt); remain > 0 {
+		r.skip(int(remain))
 	}
 	if r.err != nil {
-		return nil, r.err
+		return r.err
 	}
-	return nil, nil
+	return nil
 }
 
-type exHeaderReader func(r *Reader, h *Header, size int) (remain int, err error)
+type exHeaderReader func(h *Header, d []byte) error
 
 var exHeaderReaders = map[uint8]exHeaderReader{
 	0x00: readHeaderCRC,
 	0x01: readFilename,
 	0x02: readDirectory,
+	0x3f: readComment,
 	0x40: readDOSAttr,
 	0x41: readWinTime,
 	0x42: readWinSize,
@@ -245,16 +502,28 @@ var exHeaderReaders = map[uint8]exHeaderReader{
 	0x54: readUNIXTime,
 }
 
-func readAllExtendedHeaders(r *Reader, h *Header, size uint16) error {
+// readAllExtendedHeaders reads extended headers.  width is size of "next
+// size" fields: 2 for level 1 and 2, or 4 for level 3.
+func readAllExtendedHeaders(r *Reader, h *Header, size int, width int) error {
 	if r.err != nil {
 		return r.err
 	}
+	// Extra is carved from a chunk shared by headers, as long as it fits.
+	if len(r.extras) < maxSharedExtras {
+		r.extras = make([]ExtendedHeader, extrasSize)
+	}
+	h.Extra = r.extras[:0:maxSharedExtras]
+	defer func() {
+		n := min(len(h.Extra), maxSharedExtras)
+		r.extras = r.extras[n:]
+		h.Extra = h.Extra[:len(h.Extra):len(h.Extra)]
+	}()
 	for size > 0 {
-		if size < 3 {
+		if size < 1+width {
 			r.err = errTooShortExtendedHeader
 			return r.err
 		}
-		size, r.err = readExtendedHeader(r, h, size)
+		size, r.err = readExtendedHeader(r, h, size, width)
 		if r.err != nil {
 			return r.err
 		}
@@ -262,99 +531,201 @@ func readAllExtendedHeaders(r *Reader, h *Header, size uint16) error {
 	return nil
 }
 
-func readExtendedHeader(r *Reader, h *Header, size uint16) (uint16, error) {
+func readExtendedHeader(r *Reader, h *Header, size int, width int) (int, error) {
 	t, err := r.readUint8()
 	if err != nil {
 		return 0, err
 	}
-	proc, ok := exHeaderReaders[t]
-	remain := int(size) - 3
-	if ok {
-		remain, err = proc(r, h, remain)
-		if err != nil {
+	var d []byte
+	if t == 0x00 {
+		d, err = r.readHeaderCRCBytes(size - 1 - width)
+	} else {
+		d, err = r.readBytes(size - 1 - width)
+	}
+	if err != nil {
+		return 0, err
+	}
+	h.Extra = append(h.Extra, ExtendedHeader{Type: t, Data: d})
+	if proc, ok := exHeaderReaders[t]; ok {
+		if err := proc(h, d); err != nil {
 			return 0, err
 		}
-	}
-	if remain > 0 {
-		r.skip(remain)
+	} else {
+		readCustomExHeader(h, t, d)
 	}
 	h.ExtendedHeaderSize += uint64(size)
-	return r.readUint16()
+	if width == 4 {
+		n, err := r.readUint32()
+		return int(n), err
+	}
+	n, err := r.readUint16()
+	return int(n), err
 }
 
-func readHeaderCRC(r *Reader, h *Header, size int) (remain int, err error) {
-	crc := new(uint16)
-	*crc, err = r.readUint16NoCRC()
-	if err == nil {
-		h.HeaderCRC = crc
+func readHeaderCRC(h *Header, d []byte) error {
+	if len(d) < 2 {
+		return errTooShortExtendedHeader
 	}
-	return remain - 2, err
+	crc := binary.LittleEndian.Uint16(d)
+	h.HeaderCRC = &crc
+	return nil
 }
 
-func readFilename(r *Reader, h *Header, size int) (remain int, err error) {
-	h.Name, err = r.readStringN(size)
-	return 0, err
+func readFilename(h *Header, d []byte) error {
+	h.Name = string(d)
+	return nil
 }
 
-func readDirectory(r *Reader, h *Header, size int) (remain int, err error) {
-	d, err := r.readBytes(size)
+func readDirectory(h *Header, d []byte) error {
+	d = bytes.Clone(d)
 	for i, b := range d {
 		if b == 0xff {
 			d[i] = os.PathSeparator
 		}
 	}
 	h.Dir = string(d)
-	return 0, err
+	return nil
 }
 
-func readDOSAttr(r *Reader, h *Header, size int) (remain int, err error) {
-	h.DOS.Attr, err = r.readUint16()
-	return size - 2, err
+func readComment(h *Header, d []byte) error {
+	h.Comment = string(d)
+	return nil
 }
 
-func readWinTime(r *Reader, h *Header, size int) (remain int, err error) {
-	// FIXME: parse Windows time.
-	return size, r.err
+func readDOSAttr(h *Header, d []byte) error {
+	if len(d) < 2 {
+		return errTooShortExtendedHeader
+	}
+	h.DOS.Attr = binary.LittleEndian.Uint16(d)
+	return nil
 }
 
-func readWinSize(r *Reader, h *Header, size int) (remain int, err error) {
-	h.PackedSize, _ = r.readUint64()
-	h.OriginalSize, err = r.readUint64()
-	return size - 16, err
+func readWinTime(h *Header, d []byte) error {
+	if len(d) < 24 {
+		return nil
+	}
+	h.Windows.CreationTime = fromFileTime(binary.LittleEndian.Uint64(d))
+	h.Windows.ModificationTime = fromFileTime(binary.LittleEndian.Uint64(d[8:]))
+	h.Windows.AccessTime = fromFileTime(binary.LittleEndian.Uint64(d[16:]))
+	return nil
+}
+
+func readWinSize(h *Header, d []byte) error {
+	if len(d) < 16 {
+		return errTooShortExtendedHeader
+	}
+	h.PackedSize = binary.LittleEndian.Uint64(d)
+	h.OriginalSize = binary.LittleEndian.Uint64(d[8:])
+	return nil
+}
+
+func readUNIXPerm(h *Header, d []byte) error {
+	if len(d) < 2 {
+		return errTooShortExtendedHeader
+	}
+	h.UNIX.Perm = binary.LittleEndian.Uint16(d)
+	return nil
 }
 
-func readUNIXPerm(r *Reader, h *Header, size int) (remain int, err error) {
-	h.UNIX.Perm, err = r.readUint16()
-	return size - 2, err
+func readUNIXGIDUID(h *Header, d []byte) error {
+	if len(d) < 4 {
+		return errTooShortExtendedHeader
+	}
+	h.UNIX.GID = binary.LittleEndian.Uint16(d)
+	h.UNIX.UID = binary.LittleEndian.Uint16(d[2:])
+	return nil
 }
 
-func readUNIXGIDUID(r *Reader, h *Header, size int) (remain int, err error) {
-	h.UNIX.GID, _ = r.readUint16()
-	h.UNIX.UID, err = r.readUint16()
-	return size - 4, err
+func readUNIXGroup(h *Header, d []byte) error {
+	h.UNIX.Group = string(d)
+	return nil
 }
 
-func readUNIXGroup(r *Reader, h *Header, size int) (remain int, err error) {
-	h.UNIX.Group, err = r.readStringN(size)
-	return 0, err
+func readUNIXUser(h *Header, d []byte) error {
+	h.UNIX.User = string(d)
+	return nil
 }
 
-func readUNIXUser(r *Reader, h *Header, size int) (remain int, err error) {
-	h.UNIX.User, err = r.readStringN(size)
-	return 0, err
+func readUNIXTime(h *Header, d []byte) error {
+	if len(d) < 4 {
+		return errTooShortExtendedHeader
+	}
+	h.UNIX.Time = time.Unix(int64(binary.LittleEndian.Uint32(d)), 0)
+	return nil
 }
 
-func readUNIXTime(r *Reader, h *Header, size int) (remain int, err error) {
-	h.UNIX.Time, err = r.readTime()
-	return size - 4, err
+// splitComment splits a name of level 0 and 1 headers into a file name and
+// a comment, which are separated by NUL.
+func splitComment(s string) (name, comment string) {
+	name, comment, _ = strings.Cut(s, "\x00")
+	return name, comment
 }
 
-func fromDOSTimestamp(v uint32) time.Time {
+// fileTimeEpochDiff is 100-nanosecond intervals from 1601-01-01 to
+// 1970-01-01.
+const fileTimeEpochDiff = 116444736000000000
+
+// fromFileTime converts Windows FILETIME, which counts 100-nanosecond
+// intervals since 1601-01-01 UTC, to time.Time.  Zero means no time.
+func fromFileTime(v uint64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	d := int64(v - fileTimeEpochDiff)
+	return time.Unix(d/1e7, d%1e7*100)
+}
+
+// toFileTime converts time.Time to Windows FILETIME.  Zero time is
+// converted to zero.
+func toFileTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix()*1e7+int64(t.Nanosecond()/100)) + fileTimeEpochDiff
+}
+
+// fromDOSTimestamp converts DOS timestamp v in loc to time.  loc is
+// time.Local when it is nil.
+func fromDOSTimestamp(v uint32, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.Local
+	}
 	y := int(1980 + (v>>25)&0x7f)
 	m := int((v >> 21) & 0x0f)
 	d := int((v >> 16) & 0x1f)
 	h := int((v >> 11) & 0x1f)
 	mi := int((v >> 5) & 0x3f)
 	s := int(v&0x1f) * 2
-	return time.Date(y, time.Month(m), d, h, mi, s, 0, time.Local)
+	return time.Date(y, time.Month(m), d, h, mi, s, 0, loc)
+}
+
+// unixTime32 converts t to 32-bit UNIX time.  Zero time is converted to the
+// UNIX epoch.
+func unixTime32(t time.Time) (uint32, error) {
+	if t.IsZero() {
+		return 0, nil
+	}
+	u := t.Unix()
+	if u < 0 || u > math.MaxUint32 {
+		return 0, errTimeOutOfRange
+	}
+	return uint32(u), nil
+}
+
+// toDOSTimestamp converts t to DOS timestamp in loc, which is time.Local
+// when it is nil.  t is clamped to the range of DOS timestamp: from 1980 to
+// 2107.
+func toDOSTimestamp(t time.Time, loc *time.Location) uint32 {
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	switch {
+	case t.Year() < 1980:
+		return 1<<21 | 1<<16
+	case t.Year() > 2107:
+		return 127<<25 | 12<<21 | 31<<16 | 23<<11 | 59<<5 | 29
+	}
+	return uint32(t.Year()-1980)<<25 | uint32(t.Month())<<21 | uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
 }
@@ -1,8 +1,11 @@
 package lha
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"os"
+	"runtime"
 	"testing"
 	"time"
 
@@ -11,7 +14,7 @@ import (
 
 type entry struct {
 	Header *Header
-	Size   int
+	Size   int64
 	Err    error
 }
 
@@ -64,12 +67,17 @@ func TestHeader_Generic(t *testing.T) {
 	assert.Equal(t, []*entry{
 		{
 			Header: &Header{
-				Size:      30,
-				Sum:       95,
-				Method:    "-lh0-",
-				Time:      toHeaderTime(t, "2005-10-15 01:31:34"),
-				Attribute: 0x20,
-				Name:      "NULLFILE",
+				Size:       30,
+				Sum:        95,
+				Method:     "-lh0-",
+				Time:       toHeaderTime(t, "2005-10-15 01:31:34"),
+				Attribute:  0x20,
+				Name:       "NULLFILE",
+				TimeSource: TimeSourceDOS,
+				DOS: HeaderDOS{
+					Time:    toHeaderTime(t, "2005-10-15 01:31:34"),
+					RawTime: 0x334f0bf1,
+				},
 			},
 			Size: 0,
 			Err:  nil,
@@ -89,6 +97,11 @@ func TestHeader_Lv0(t *testing.T) {
 				Attribute:  0x20,
 				Name:       "nullfile",
 				ExtendType: ExtendUNIX,
+				TimeSource: TimeSourceDOS,
+				DOS: HeaderDOS{
+					Time:    toHeaderTime(t, "2005-10-15 01:31:34"),
+					RawTime: 0x334f0bf1,
+				},
 				UNIX: HeaderUNIX{
 					Perm: 0100644,
 					GID:  100,
@@ -116,8 +129,18 @@ func TestHeader_Lv1(t *testing.T) {
 				Level:      1,
 				OSID:       0x55,
 				Name:       "nullfile",
+				TimeSource: TimeSourceDOS,
+				DOS: HeaderDOS{
+					Time:    toHeaderTime(t, "2005-10-15 01:31:34"),
+					RawTime: 0x334f0bf1,
+				},
 
 				ExtendedHeaderSize: 19,
+				Extra: []ExtendedHeader{
+					{Type: 0x50, Data: []byte{0xa4, 0x81}},
+					{Type: 0x51, Data: []byte{0x64, 0x00, 0xf5, 0x01}},
+					{Type: 0x54, Data: []byte{0x66, 0xdd, 0x4f, 0x43}},
+				},
 				UNIX: HeaderUNIX{
 					Perm: 0100644,
 					GID:  100,
@@ -150,6 +173,12 @@ func TestHeader_Lv2(t *testing.T) {
 				HeaderCRC: uint16p(0x9e7f),
 
 				ExtendedHeaderSize: 28,
+				Extra: []ExtendedHeader{
+					{Type: 0x00, Data: []byte{0x7f, 0x9e}},
+					{Type: 0x50, Data: []byte{0xa4, 0x81}},
+					{Type: 0x51, Data: []byte{0x64, 0x00, 0xf5, 0x01}},
+					{Type: 0x01, Data: []byte("nullfile")},
+				},
 				UNIX: HeaderUNIX{
 					Perm: 0100644,
 					GID:  100,
@@ -161,3 +190,70 @@ func TestHeader_Lv2(t *testing.T) {
 		},
 	}, entries)
 }
+
+func TestHeader_Comment(t *testing.T) {
+	t.Run("lv0", func(t *testing.T) {
+		b := testArchive(testLv0Entry("-lh0-", "foo.txt\x00first file", []byte("Hello LHA\n")))
+		headers, bodies := testReadAll(t, b)
+		assert.Equal(t, "foo.txt", headers[0].Name)
+		assert.Equal(t, "first file", headers[0].Comment)
+		assert.Equal(t, "Hello LHA\n", string(bodies[0]))
+	})
+	t.Run("lv2", func(t *testing.T) {
+		b := testWriteHeader(t, &Header{Name: "foo.txt", Comment: "first file"})
+		headers, _ := testReadAll(t, b)
+		assert.Equal(t, "foo.txt", headers[0].Name)
+		assert.Equal(t, "first file", headers[0].Comment)
+		if !hasExtendedType(headers[0], 0x3f) {
+			t.Fatal("no comment extended header")
+		}
+	})
+}
+
+func TestHeader_Lv3HugeExtendedHeader(t *testing.T) {
+	// a level 3 header which has an extended header of 4GiB, but it ends.
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(4))
+	b.WriteString("-lh0-")
+	binary.Write(&b, binary.LittleEndian, [3]uint32{})
+	b.Write([]byte{0x20, 3, 0, 0, 'U'})
+	binary.Write(&b, binary.LittleEndian, [2]uint32{0xffffffff, 0xffffffff})
+	b.WriteString("\x01abc")
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := NewReader(bytes.NewReader(b.Bytes())).NextHeader()
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Fatalf("too large allocation: %d bytes", n)
+	}
+}
+
+func TestHeader_ModTime(t *testing.T) {
+	mtime := time.Unix(1600000000, 0)
+	for _, tc := range []struct {
+		source TimeSource
+		mtime  time.Time
+		want   int
+	}{
+		{TimeSourceHeader, mtime.Add(-time.Second), 1},
+		{TimeSourceHeader, mtime, 0},
+		{TimeSourceHeader, mtime.Add(time.Second), -1},
+		{TimeSourceDOS, mtime.Add(time.Second), 0},
+		{TimeSourceDOS, mtime.Add(2 * time.Second), -1},
+	} {
+		h := &Header{Time: mtime, TimeSource: tc.source}
+		assert.Equal(t, tc.want, compareModTime(h, tc.mtime))
+	}
+
+	// UNIX time in extensions precedes DOS timestamp.
+	h := &Header{Time: mtime, TimeSource: TimeSourceDOS, UNIX: HeaderUNIX{Time: mtime.Add(time.Hour)}}
+	got, src := h.ModTime()
+	assert.Equal(t, TimeSourceUNIX, src)
+	assert.Equal(t, mtime.Add(time.Hour).Unix(), got.Unix())
+	assert.Equal(t, 0, compareModTime(h, mtime.Add(time.Hour)))
+	assert.Equal(t, -1, compareModTime(h, mtime.Add(time.Hour+time.Second)))
+}
@@ -0,0 +1,180 @@
+package lha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/internal/assert"
+)
+
+// testLargeSize is a size over 4GiB.
+const testLargeSize = 1<<32 + 10
+
+// zeroReader provides infinite zeros, to make synthetic sparse inputs.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// countWriter counts written bytes, and discards them.  It is used as a
+// compressor which compresses zeros to nothing.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func (w *countWriter) Close() error { return nil }
+
+func TestLarge_Header(t *testing.T) {
+	h := &Header{
+		Method:       "-lh0-",
+		Name:         "large",
+		PackedSize:   testLargeSize,
+		OriginalSize: testLargeSize + 1,
+	}
+	b, err := marshalHeaderLv2(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x ExtendedHeader
+	for _, e := range h.Extra {
+		if e.Type == 0x42 {
+			x = e
+		}
+	}
+	assert.Equal(t, uint64(testLargeSize), binary.LittleEndian.Uint64(x.Data))
+	assert.Equal(t, uint64(testLargeSize+1), binary.LittleEndian.Uint64(x.Data[8:]))
+
+	r := NewReader(bytes.NewReader(b))
+	got, err := r.NextHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(testLargeSize), got.PackedSize)
+	assert.Equal(t, uint64(testLargeSize+1), got.OriginalSize)
+}
+
+func TestLarge_Skip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip large data in short mode")
+	}
+	h := &Header{
+		Method:       "-lh0-",
+		Name:         "large",
+		PackedSize:   testLargeSize,
+		OriginalSize: testLargeSize,
+	}
+	b, err := marshalHeaderLv2(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2 := testLv0Entry("-lh0-", "next", []byte("next entry"))
+	r := NewReader(io.MultiReader(
+		bytes.NewReader(b),
+		io.LimitReader(zeroReader{}, testLargeSize),
+		bytes.NewReader(testArchive(e2)),
+	))
+	if _, err := r.NextHeader(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.NextHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "next", got.Name)
+}
+
+func TestLarge_Writer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip large data in short mode")
+	}
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.RegisterCompressor("-zro-", func(io.Writer) (io.WriteCloser, error) {
+		return &countWriter{}, nil
+	})
+	fw, err := w.CreateHeader(&Header{Method: "-zro-", Name: "zeros"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(fw, zeroReader{}, testLargeSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(bytes.NewReader(b.Bytes()))
+	r.RegisterDecompressor("-zro-", func(_ io.Reader, size int64) io.Reader {
+		return io.LimitReader(zeroReader{}, size)
+	})
+	h, err := r.NextHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasExtendedType(h, 0x42) {
+		t.Fatal("no 64-bit size extended header")
+	}
+	assert.Equal(t, uint64(testLargeSize), h.OriginalSize)
+	assert.Equal(t, uint64(0), h.PackedSize)
+	// CRC-16 of zeros is zero.
+	assert.Equal(t, crc16.Checksum(make([]byte, 16), crc16.IBMTable), h.CRC)
+	n, err := r.Decode(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(testLargeSize), n)
+}
+
+// patternReader provides infinite periodic bytes.
+type patternReader struct {
+	off int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r.off % 251)
+		r.off++
+	}
+	return len(p), nil
+}
+
+func TestLarge_StaticMethod(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip large data in short mode")
+	}
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	fw, err := w.CreateHeader(&Header{Method: "-lh5-", Name: "pattern"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(fw, &patternReader{}, testLargeSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(bytes.NewReader(b.Bytes()))
+	h, err := r.NextHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(testLargeSize), h.OriginalSize)
+	// Decode verifies CRC of the decoded data.
+	n, err := r.Decode(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(testLargeSize), n)
+}
@@ -0,0 +1,271 @@
+package lha
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var osNames = map[uint8]string{
+	0:   "generic",
+	'2': "OS/2",
+	'3': "OS386",
+	'9': "OS-9",
+	'A': "Amiga",
+	'C': "CP/M",
+	'F': "FLEX",
+	'H': "Human68K",
+	'J': "Java",
+	'K': "OS-9/68K",
+	'M': "MS-DOS",
+	'R': "Runser",
+	'T': "TownsOS",
+	'U': "UNIX",
+	'W': "Windows NT",
+	'X': "XOSK",
+	'a': "Atari",
+	'm': "MacOS",
+	'w': "Windows 95",
+}
+
+// osID returns ID of OS which created the header.
+func (h *Header) osID() uint8 {
+	if h.Level == 0 {
+		return uint8(h.ExtendType)
+	}
+	return h.OSID
+}
+
+// ListTimes is timestamps of an entry, from all sources.
+type ListTimes struct {
+	// DOS is timestamp in the header of level 0 or 1.
+	DOS *time.Time `json:"dos,omitempty"`
+	// UNIX is timestamp in the header of level 2 or 3, or in extended
+	// header for UNIX.
+	UNIX *time.Time `json:"unix,omitempty"`
+
+	WindowsCreation     *time.Time `json:"windowsCreation,omitempty"`
+	WindowsModification *time.Time `json:"windowsModification,omitempty"`
+	WindowsAccess       *time.Time `json:"windowsAccess,omitempty"`
+}
+
+// ListEntry is a normalized entry for listing, which is suitable to be
+// marshaled as JSON.
+type ListEntry struct {
+	Path         string    `json:"path"`
+	Comment      string    `json:"comment,omitempty"`
+	Method       string    `json:"method"`
+	PackedSize   uint64    `json:"packedSize"`
+	OriginalSize uint64    `json:"originalSize"`
+	Ratio        float64   `json:"ratio"`
+	CRC          string    `json:"crc"`
+	Level        uint8     `json:"level"`
+	OS           string    `json:"os"`
+	Time         time.Time `json:"time"`
+	TimeSource   string    `json:"timeSource"`
+	Times        ListTimes `json:"times"`
+	Mode         string    `json:"mode"`
+	Attribute    uint8     `json:"attribute"`
+	UNIXPerm     string    `json:"unixPerm,omitempty"`
+	UID          *uint16   `json:"uid,omitempty"`
+	GID          *uint16   `json:"gid,omitempty"`
+	User         string    `json:"user,omitempty"`
+	Group        string    `json:"group,omitempty"`
+
+	// ExtendedTypes is types of extended headers.  It is not []uint8, to be
+	// marshaled as an array of numbers instead of base64.
+	ExtendedTypes []int `json:"extendedTypes"`
+}
+
+func timep(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func hasExtendedType(h *Header, types ...uint8) bool {
+	for _, x := range h.Extra {
+		for _, t := range types {
+			if x.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewListEntry creates a ListEntry from a header.
+func NewListEntry(h *Header) *ListEntry {
+	e := &ListEntry{
+		Path:         filepath.ToSlash(h.Path()),
+		Comment:      h.Comment,
+		Method:       h.Method,
+		PackedSize:   h.bodySize(),
+		OriginalSize: h.OriginalSize,
+		CRC:          fmt.Sprintf("%04x", h.CRC),
+		Level:        h.Level,
+		Time:         h.Time,
+		TimeSource:   h.TimeSource.String(),
+		Mode:         h.Mode().String(),
+		Attribute:    h.Attribute,
+		User:         h.UNIX.User,
+		Group:        h.UNIX.Group,
+		Times: ListTimes{
+			UNIX:                timep(h.UNIX.Time),
+			WindowsCreation:     timep(h.Windows.CreationTime),
+			WindowsModification: timep(h.Windows.ModificationTime),
+			WindowsAccess:       timep(h.Windows.AccessTime),
+		},
+		ExtendedTypes: make([]int, len(h.Extra)),
+	}
+	for i, x := range h.Extra {
+		e.ExtendedTypes[i] = int(x.Type)
+	}
+	if h.OriginalSize != 0 {
+		e.Ratio = float64(e.PackedSize) / float64(h.OriginalSize)
+	}
+	if name, ok := osNames[h.osID()]; ok {
+		e.OS = name
+	} else {
+		e.OS = fmt.Sprintf("unknown(0x%02x)", h.osID())
+	}
+	if h.Level <= 1 {
+		e.Times.DOS = timep(h.DOS.Time)
+	} else if e.Times.UNIX == nil {
+		e.Times.UNIX = timep(h.Time)
+	}
+	if h.UNIX.Perm != 0 {
+		e.UNIXPerm = strconv.FormatUint(uint64(h.UNIX.Perm), 8)
+	}
+	hasUNIX := h.Level == 0 && h.ExtendType == ExtendUNIX
+	if hasUNIX || hasExtendedType(h, 0x51) {
+		uid, gid := h.UNIX.UID, h.UNIX.GID
+		e.UID, e.GID = &uid, &gid
+	}
+	return e
+}
+
+var listCSVHeader = []string{
+	"path", "method", "packedSize", "originalSize", "ratio", "crc", "level",
+	"os", "time", "dosTime", "unixTime", "windowsCreation",
+	"windowsModification", "windowsAccess", "mode", "attribute", "unixPerm",
+	"uid", "gid", "user", "group", "extendedTypes", "comment", "timeSource",
+}
+
+func formatTimep(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func formatUint16p(v *uint16) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*v))
+}
+
+// CSVRecord returns the entry as a CSV record, which corresponds to columns
+// of ListCSVHeader.
+func (e *ListEntry) CSVRecord() []string {
+	types := make([]string, len(e.ExtendedTypes))
+	for i, t := range e.ExtendedTypes {
+		types[i] = fmt.Sprintf("0x%02x", t)
+	}
+	return []string{
+		e.Path,
+		e.Method,
+		strconv.FormatUint(e.PackedSize, 10),
+		strconv.FormatUint(e.OriginalSize, 10),
+		strconv.FormatFloat(e.Ratio, 'f', 4, 64),
+		e.CRC,
+		strconv.Itoa(int(e.Level)),
+		e.OS,
+		e.Time.Format(time.RFC3339Nano),
+		formatTimep(e.Times.DOS),
+		formatTimep(e.Times.UNIX),
+		formatTimep(e.Times.WindowsCreation),
+		formatTimep(e.Times.WindowsModification),
+		formatTimep(e.Times.WindowsAccess),
+		e.Mode,
+		strconv.Itoa(int(e.Attribute)),
+		e.UNIXPerm,
+		formatUint16p(e.UID),
+		formatUint16p(e.GID),
+		e.User,
+		e.Group,
+		strings.Join(types, " "),
+		e.Comment,
+		e.TimeSource,
+	}
+}
+
+// ListCSVHeader returns names of columns for ListEntry.CSVRecord.
+func ListCSVHeader() []string {
+	return append([]string(nil), listCSVHeader...)
+}
+
+// ListFormat is format of listing.
+type ListFormat int
+
+const (
+	// ListJSON outputs an JSON object per line for each entry.
+	ListJSON ListFormat = iota
+	// ListCSV outputs CSV with a header row.
+	ListCSV
+)
+
+// List reads all headers in an archive from r, and writes them to w in the
+// format.
+func List(w io.Writer, r io.Reader, format ListFormat) error {
+	return ListWithOptions(w, r, format, nil)
+}
+
+// ListWithOptions is List which reads the archive with opts.
+func ListWithOptions(w io.Writer, r io.Reader, format ListFormat, opts *ReaderOptions) error {
+	var (
+		emit   func(*ListEntry) error
+		finish = func() error { return nil }
+	)
+	switch format {
+	case ListJSON:
+		enc := json.NewEncoder(w)
+		emit = func(e *ListEntry) error {
+			return enc.Encode(e)
+		}
+	case ListCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(listCSVHeader); err != nil {
+			return err
+		}
+		emit = func(e *ListEntry) error {
+			return cw.Write(e.CSVRecord())
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return fmt.Errorf("unknown list format: %d", format)
+	}
+	lr := NewReaderWithOptions(r, opts)
+	for {
+		h, err := lr.NextHeader()
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			return finish()
+		}
+		if err := emit(NewListEntry(h)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package lha
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testList(t *testing.T, name string, format ListFormat) []byte {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var b bytes.Buffer
+	if err := List(&b, f, format); err != nil {
+		t.Fatalf("List failed: %s", err)
+	}
+	return b.Bytes()
+}
+
+func TestList_JSON(t *testing.T) {
+	out := testList(t, "testdata/header-lv2.lzh", ListJSON)
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]any{
+		"path":          "nullfile",
+		"method":        "-lh5-",
+		"packedSize":    0.0,
+		"originalSize":  0.0,
+		"ratio":         0.0,
+		"crc":           "0000",
+		"level":         2.0,
+		"os":            "UNIX",
+		"time":          got["time"],
+		"timeSource":    "header",
+		"times":         map[string]any{"unix": got["time"]},
+		"mode":          "-rw-r--r--",
+		"attribute":     32.0,
+		"unixPerm":      "100644",
+		"uid":           501.0,
+		"gid":           100.0,
+		"extendedTypes": []any{0.0, 80.0, 81.0, 1.0},
+	}, got)
+}
+
+func TestList_CSV(t *testing.T) {
+	out := testList(t, "testdata/header-lv1.lzh", ListCSV)
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("unexpected number of records: %d", len(records))
+	}
+	assert.Equal(t, ListCSVHeader(), records[0])
+	got := map[string]string{}
+	for i, k := range records[0] {
+		got[k] = records[1][i]
+	}
+	assert.Equal(t, "nullfile", got["path"])
+	assert.Equal(t, "1", got["level"])
+	assert.Equal(t, "-rw-r--r--", got["mode"])
+	assert.Equal(t, "501", got["uid"])
+	assert.Equal(t, "0x50 0x51 0x54", got["extendedTypes"])
+	assert.Equal(t, "dos", got["timeSource"])
+	if got["dosTime"] == "" || got["unixTime"] == "" {
+		t.Fatalf("times should be filled: %+v", got)
+	}
+}
+
+func TestList_Comment(t *testing.T) {
+	b := testArchive(testLv0Entry("-lh0-", "foo.txt\x00first file", nil))
+	var out bytes.Buffer
+	if err := List(&out, bytes.NewReader(b), ListJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got ListEntry
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "foo.txt", got.Path)
+	assert.Equal(t, "first file", got.Comment)
+}
+
+func TestListWithOptions_Location(t *testing.T) {
+	list := func(tz *time.Location, opts *ReaderOptions) string {
+		t.Helper()
+		defer func(loc *time.Location) { time.Local = loc }(time.Local)
+		time.Local = tz
+		f, err := os.Open("testdata/header-lv0.lzh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var b bytes.Buffer
+		if err := ListWithOptions(&b, f, ListJSON, opts); err != nil {
+			t.Fatalf("ListWithOptions failed: %s", err)
+		}
+		return b.String()
+	}
+	tz1 := time.FixedZone("TZ1", 9*60*60)
+	tz2 := time.FixedZone("TZ2", -5*60*60)
+	opts := &ReaderOptions{Location: time.UTC}
+	assert.Equal(t, list(tz1, opts), list(tz2, opts))
+	if list(tz1, nil) == list(tz2, nil) {
+		t.Fatal("listings without location should depend on the local time zone")
+	}
+}
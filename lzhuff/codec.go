@@ -0,0 +1,62 @@
+package lzhuff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUnknownMethod is returned by readers and writers for unknown methods.
+var ErrUnknownMethod = errors.New("lzhuff: unknown method")
+
+// methods is parameters of static huffman methods.
+var methods = map[string]staticParams{
+	"lh4": {12, 4, 14},
+	"lh5": {13, 4, 14},
+	"lh6": {15, 5, 16},
+	"lh7": {16, 5, 17},
+}
+
+// lookupMethod returns parameters of method, which is like "-lh5-" or
+// "lh5".
+func lookupMethod(method string) (staticParams, error) {
+	sp, ok := methods[strings.Trim(method, "-")]
+	if !ok {
+		return staticParams{}, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+	return sp, nil
+}
+
+// NewReader creates a reader which decodes a bare stream of method (-lh4-
+// to -lh7-) read from r, without LHA headers.  originalSize is size of the
+// decoded data.  Read of the returned reader fails with ErrUnknownMethod for
+// unknown methods.
+func NewReader(r io.Reader, method string, originalSize int64) io.Reader {
+	sp, err := lookupMethod(method)
+	if err != nil {
+		return errReadWriter{err}
+	}
+	return NewStaticReader(r, sp.dictBits, sp.pbits, sp.pnum, originalSize)
+}
+
+// NewWriter creates a writer which encodes data with method (-lh4- to -lh7-)
+// to w, without LHA headers.  Encoded data is written when the writer is
+// closed.  w is not closed.  Write and Close of the returned writer fail with
+// ErrUnknownMethod for unknown methods.
+func NewWriter(w io.Writer, method string) io.WriteCloser {
+	sp, err := lookupMethod(method)
+	if err != nil {
+		return errReadWriter{err}
+	}
+	return NewStaticEncoder(w, sp.dictBits, sp.pbits, sp.pnum)
+}
+
+// errReadWriter is a reader and a writer which always fail with err.
+type errReadWriter struct {
+	err error
+}
+
+func (e errReadWriter) Read([]byte) (int, error)  { return 0, e.err }
+func (e errReadWriter) Write([]byte) (int, error) { return 0, e.err }
+func (e errReadWriter) Close() error              { return e.err }
@@ -0,0 +1,44 @@
+package lzhuff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	data := testText(200000, 7)
+	for _, method := range []string{"-lh4-", "-lh5-", "lh6", "lh7"} {
+		t.Run(method, func(t *testing.T) {
+			var b bytes.Buffer
+			w := NewWriter(&b, method)
+			if _, err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(NewReader(&b, method, int64(len(data))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("decoded data mismatch")
+			}
+		})
+	}
+}
+
+func TestCodec_UnknownMethod(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(nil), "-lh1-", 1).Read(make([]byte, 1)); !errors.Is(err, ErrUnknownMethod) {
+		t.Fatalf("unexpected error for reader: %v", err)
+	}
+	w := NewWriter(io.Discard, "-lzs-")
+	if _, err := w.Write([]byte("a")); !errors.Is(err, ErrUnknownMethod) {
+		t.Fatalf("unexpected error for writer: %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, ErrUnknownMethod) {
+		t.Fatalf("unexpected error for closing writer: %v", err)
+	}
+}
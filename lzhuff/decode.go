@@ -1,6 +1,7 @@
 package lzhuff
 
 import (
+	"bytes"
 	"io"
 
 	"github.com/koron-go/lha/slide"
@@ -12,32 +13,136 @@ type Decoder interface {
 	DecodeP() (uint16, error)
 }
 
+// Resetter resets a decoder to read from r, reusing its buffers.
+type Resetter interface {
+	Reset(r io.Reader)
+}
+
 // Decode decodes huffman encoding.
-func Decode(d Decoder, w io.Writer, bits, adjust uint, size int) (n int, crc uint16, err error) {
+func Decode(d Decoder, w io.Writer, bits, adjust uint, size int64) (n int64, crc uint16, err error) {
 	sw := slide.NewWriter(w, bits)
-	for sw.Len() < size {
-		c, err := d.DecodeC()
-		if err != nil {
-			return sw.Len(), 0, err
-		}
-		if c < 256 {
-			err := sw.WriteByte(byte(c))
-			if err != nil {
-				return sw.Len(), 0, err
-			}
-			continue
-		}
-		ln := int(uint(c) - adjust)
-		off, err := d.DecodeP()
-		if err != nil {
-			return sw.Len(), 0, nil
-		}
-		if _, err := sw.WriteCopy(int(off), ln); err != nil {
-			return sw.Len(), 0, nil
-		}
+	if err := decodeTokens(d, sw, adjust, size); err != nil {
+		return sw.Len(), 0, err
 	}
 	if err := sw.Flush(); err != nil {
 		return sw.Len(), 0, err
 	}
 	return sw.Len(), sw.CRC16(), nil
 }
+
+// decodeTokens decodes tokens with d and writes them to sw, until sw has limit
+// bytes.  The static decoder decodes them in its own loop.
+func decodeTokens(d Decoder, sw *slide.Writer, adjust uint, limit int64) error {
+	if sd, ok := d.(*staticDecoder); ok {
+		return sd.decodeTokens(sw, adjust, limit)
+	}
+	for sw.Len() < limit {
+		if err := decodeToken(d, sw, adjust); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeToken decodes a literal or a match, and writes it to sw.
+func decodeToken(d Decoder, sw *slide.Writer, adjust uint) error {
+	c, err := d.DecodeC()
+	if err != nil {
+		return err
+	}
+	if c < 256 {
+		return sw.WriteByte(byte(c))
+	}
+	ln := int(uint(c) - adjust)
+	off, err := d.DecodeP()
+	if err != nil {
+		return err
+	}
+	_, err = sw.WriteCopy(int(off), ln)
+	return err
+}
+
+// minFill is the minimum number of bytes decoded at once by decodeReader.
+const minFill = 4096
+
+type decodeReader struct {
+	d      Decoder
+	sw     *slide.Writer
+	out    bytes.Buffer
+	adjust uint
+	size   int64
+	remain int64
+	err    error
+}
+
+// NewDecodeReader creates a reader which decodes huffman encoding, to
+// provide size bytes of decoded data.
+func NewDecodeReader(d Decoder, bits, adjust uint, size int64) io.Reader {
+	return newDecodeReader(d, bits, adjust, size)
+}
+
+func newDecodeReader(d Decoder, bits, adjust uint, size int64) *decodeReader {
+	dr := &decodeReader{
+		d:      d,
+		adjust: adjust,
+		size:   size,
+		remain: size,
+	}
+	dr.sw = slide.NewWriter(&dr.out, bits)
+	return dr
+}
+
+// reset resets the reader to decode size bytes with d.  It reuses the
+// window buffer.
+func (dr *decodeReader) reset(d Decoder, size int64) {
+	dr.d = d
+	dr.out.Reset()
+	dr.sw.Reset(&dr.out)
+	dr.size = size
+	dr.remain = size
+	dr.err = nil
+}
+
+func (dr *decodeReader) Read(p []byte) (int, error) {
+	if dr.remain <= 0 {
+		return 0, io.EOF
+	}
+	for dr.out.Len() == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		dr.err = dr.fill(max(len(p), minFill))
+	}
+	if int64(len(p)) > dr.remain {
+		p = p[:dr.remain]
+	}
+	n, _ := dr.out.Read(p)
+	dr.remain -= int64(n)
+	return n, nil
+}
+
+// CRC16 returns CRC-16 (IBM) of decoded data.
+func (dr *decodeReader) CRC16() uint16 {
+	return dr.sw.CRC16()
+}
+
+// done returns true when all decoded data are read.
+func (dr *decodeReader) done() bool {
+	return dr.remain <= 0
+}
+
+// fill decodes at least n bytes, or till the end of data.
+func (dr *decodeReader) fill(n int) error {
+	limit := min(dr.sw.Len()+int64(n), dr.size)
+	err := decodeTokens(dr.d, dr.sw, dr.adjust, limit)
+	if ferr := dr.sw.Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil && dr.sw.Len() >= dr.size {
+		err = io.EOF
+	}
+	if err == io.EOF && dr.sw.Len() < dr.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
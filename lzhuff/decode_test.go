@@ -0,0 +1,361 @@
+package lzhuff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/internal/assert"
+	"github.com/koron-go/lha/slide"
+)
+
+type testMethod struct {
+	name     string
+	dictBits uint
+	pbits    int
+	np       int
+}
+
+var testMethods = []testMethod{
+	{"lh5", 13, 4, 14},
+	{"lh6", 15, 5, 16},
+	{"lh7", 16, 5, 17},
+}
+
+// testText generates pseudo text which has words and numbers.
+func testText(size int, seed uint64) []byte {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	words := make([]string, 2000)
+	for i := range words {
+		w := make([]byte, 2+rnd.IntN(9))
+		for j := range w {
+			w[j] = byte('a' + rnd.IntN(26))
+		}
+		words[i] = string(w)
+	}
+	zipf := rand.NewZipf(rnd, 1.1, 1, uint64(len(words)-1))
+	var b bytes.Buffer
+	for b.Len() < size {
+		switch rnd.IntN(12) {
+		case 0:
+			fmt.Fprintf(&b, "%d", rnd.IntN(100000))
+		case 1:
+			b.WriteString(".\n")
+		default:
+			b.WriteString(words[zipf.Uint64()])
+		}
+		b.WriteByte(' ')
+	}
+	return b.Bytes()[:size]
+}
+
+func testRandom(size int, seed uint64) []byte {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	d := make([]byte, size)
+	for i := range d {
+		d[i] = byte(rnd.Uint32())
+	}
+	return d
+}
+
+var testCorpora = []struct {
+	name string
+	data []byte
+}{
+	{"empty", nil},
+	{"byte", []byte{'x'}},
+	{"repeat", bytes.Repeat([]byte{'a'}, 100000)},
+	{"random", testRandom(100000, 1)},
+	{"text", testText(1<<20, 1)},
+}
+
+func testDecode(t *testing.T, name string, d Decoder, m testMethod, want []byte) {
+	t.Helper()
+	var b bytes.Buffer
+	n, crc, err := Decode(d, &b, m.dictBits, 253, int64(len(want)))
+	if err != nil {
+		t.Fatalf("%s: decode failed: %s", name, err)
+	}
+	if n != int64(len(want)) {
+		t.Fatalf("%s: decoded size mismatch: want=%d got=%d", name, len(want), n)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Fatalf("%s: decoded data mismatch", name)
+	}
+	if w := crc16.Update(0, crc16.IBMTable, want); crc != w {
+		t.Fatalf("%s: CRC mismatch: want=%04x got=%04x", name, w, crc)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, m := range testMethods {
+		for _, c := range testCorpora {
+			t.Run(m.name+"/"+c.name, func(t *testing.T) {
+				enc := encode(c.data, m.dictBits, uint(m.pbits), m.np)
+				testDecode(t, "table", NewStaticDecoder(bytes.NewReader(enc), m.pbits, m.np), m, c.data)
+			})
+		}
+	}
+}
+
+// goldenText is size, CRC and SHA-256 of data in testdata/text.*, which are
+// pseudo text encoded by each method.  They were decoded by the former bit by
+// bit decoder.
+var goldenText = struct {
+	size   int64
+	crc    uint16
+	sha256 string
+}{150000, 0x280d, "47d30f4e462b0f561ff8f9996af728e249dbe7155f017552c44699fbf5a977ba"}
+
+func TestDecodeGolden(t *testing.T) {
+	for _, m := range testMethods {
+		t.Run(m.name, func(t *testing.T) {
+			enc, err := os.ReadFile("testdata/text." + m.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := goldenText
+			for _, r := range []io.Reader{
+				NewStaticReader(bytes.NewReader(enc), m.dictBits, m.pbits, m.np, want.size),
+				iotest.OneByteReader(NewDecodeReader(NewStaticDecoder(iotest.HalfReader(bytes.NewReader(enc)), m.pbits, m.np), m.dictBits, 253, want.size)),
+			} {
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := int64(len(got)); n != want.size {
+					t.Fatalf("decoded size mismatch: want=%d got=%d", want.size, n)
+				}
+				if crc := crc16.Update(0, crc16.IBMTable, got); crc != want.crc {
+					t.Fatalf("CRC mismatch: want=%04x got=%04x", want.crc, crc)
+				}
+				if sum := fmt.Sprintf("%x", sha256.Sum256(got)); sum != want.sha256 {
+					t.Fatalf("SHA-256 mismatch: want=%s got=%s", want.sha256, sum)
+				}
+			}
+			var b bytes.Buffer
+			n, crc, err := Decode(NewStaticDecoder(bytes.NewReader(enc), m.pbits, m.np), &b, m.dictBits, 253, want.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, want.size, n)
+			assert.Equal(t, want.crc, crc)
+		})
+	}
+}
+
+// TestDecodeTokens checks the loop of the static decoder writes same data as
+// decodeToken, even with a smaller window which is referred cyclically.
+func TestDecodeTokens(t *testing.T) {
+	for _, m := range testMethods {
+		for _, c := range testCorpora {
+			enc := encode(c.data, m.dictBits, uint(m.pbits), m.np)
+			for _, bits := range []uint{m.dictBits, m.dictBits - 2} {
+				t.Run(fmt.Sprintf("%s/%s/%d", m.name, c.name, bits), func(t *testing.T) {
+					var want, got bytes.Buffer
+					d := NewStaticDecoder(bytes.NewReader(enc), m.pbits, m.np)
+					sw := slide.NewWriter(&want, bits)
+					for sw.Len() < int64(len(c.data)) {
+						if err := decodeToken(d, sw, 253); err != nil {
+							t.Fatal(err)
+						}
+					}
+					sw.Flush()
+					sw = slide.NewWriter(&got, bits)
+					d = NewStaticDecoder(bytes.NewReader(enc), m.pbits, m.np)
+					if err := d.(*staticDecoder).decodeTokens(sw, 253, int64(len(c.data))); err != nil {
+						t.Fatal(err)
+					}
+					sw.Flush()
+					if !bytes.Equal(want.Bytes(), got.Bytes()) {
+						t.Fatal("decoded data mismatch")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	m := testMethods[0]
+	data := testText(1<<16, 2)
+	enc := encode(data, m.dictBits, uint(m.pbits), m.np)
+	d := NewStaticDecoder(bytes.NewReader(enc[:len(enc)/2]), m.pbits, m.np)
+	_, _, err := Decode(d, io.Discard, m.dictBits, 253, int64(len(data)))
+	if err == nil {
+		t.Fatal("decode truncated data should fail")
+	}
+}
+
+func TestDecodeReader(t *testing.T) {
+	for _, m := range testMethods {
+		for _, c := range testCorpora {
+			t.Run(m.name+"/"+c.name, func(t *testing.T) {
+				var enc bytes.Buffer
+				ew := NewStaticEncoder(&enc, m.dictBits, m.pbits, m.np)
+				if _, err := ew.Write(c.data); err != nil {
+					t.Fatal(err)
+				}
+				if err := ew.Close(); err != nil {
+					t.Fatal(err)
+				}
+				d := NewStaticDecoder(bytes.NewReader(enc.Bytes()), m.pbits, m.np)
+				r := NewDecodeReader(d, m.dictBits, 253, int64(len(c.data)))
+				got, err := io.ReadAll(iotest.HalfReader(r))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, c.data) {
+					t.Fatal("decoded data mismatch")
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeReaderTruncated(t *testing.T) {
+	m := testMethods[0]
+	data := testText(1<<16, 2)
+	enc := encode(data, m.dictBits, uint(m.pbits), m.np)
+	d := NewStaticDecoder(bytes.NewReader(enc[:len(enc)/2]), m.pbits, m.np)
+	_, err := io.ReadAll(NewDecodeReader(d, m.dictBits, 253, int64(len(data))))
+	if err == nil {
+		t.Fatal("decode truncated data should fail")
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := testText(1<<20, 1)
+	for _, m := range testMethods {
+		enc := encode(data, m.dictBits, uint(m.pbits), m.np)
+		b.Run(m.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				d := NewStaticDecoder(bytes.NewReader(enc), m.pbits, m.np)
+				if _, _, err := Decode(d, io.Discard, m.dictBits, 253, int64(len(data))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func benchmarkTokens(b *testing.B, ntokens int, newDecoder func() Decoder) {
+	for b.Loop() {
+		d := newDecoder()
+		for range ntokens {
+			c, err := d.DecodeC()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if c < 256 {
+				continue
+			}
+			if _, err := d.DecodeP(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkDecodeTokens measures huffman decoding only, without writing to
+// the slide window.
+func BenchmarkDecodeTokens(b *testing.B) {
+	data := testText(1<<20, 1)
+	for _, m := range testMethods {
+		var out bytes.Buffer
+		se := NewStaticEncoder(&out, m.dictBits, m.pbits, m.np).(*staticEncoder)
+		se.Write(data)
+		se.Close()
+		enc, ntokens := out.Bytes(), int(se.ntokens)
+		b.Run(m.name, func(b *testing.B) {
+			b.SetBytes(int64(len(enc)))
+			benchmarkTokens(b, ntokens, func() Decoder {
+				return NewStaticDecoder(bytes.NewReader(enc), m.pbits, m.np)
+			})
+		})
+	}
+}
+
+// TestDecodeAllocs checks decoding with a reset decoder and a reset window
+// doesn't allocate, even though there are many blocks.
+func TestDecodeAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	data := testText(1<<18, 4)
+	for _, m := range testMethods {
+		t.Run(m.name, func(t *testing.T) {
+			enc := encode(data, m.dictBits, uint(m.pbits), m.np)
+			br := bytes.NewReader(enc)
+			d := NewStaticDecoder(br, m.pbits, m.np)
+			sw := slide.NewWriter(io.Discard, m.dictBits)
+			nblocks := 0
+			allocs := testing.AllocsPerRun(5, func() {
+				br.Reset(enc)
+				d.(Resetter).Reset(br)
+				sw.Reset(io.Discard)
+				nblocks = 0
+				for sw.Len() < int64(len(data)) {
+					if d.(*staticDecoder).nblock == 0 {
+						nblocks++
+					}
+					if err := decodeToken(d, sw, 253); err != nil {
+						t.Fatal(err)
+					}
+				}
+			})
+			if nblocks < 2 {
+				t.Fatalf("too few blocks: %d", nblocks)
+			}
+			if allocs != 0 {
+				t.Fatalf("decoding allocates: %f allocs for %d blocks", allocs, nblocks)
+			}
+		})
+	}
+}
+
+func TestStaticReader(t *testing.T) {
+	m := testMethods[1]
+	d1, d2 := testText(100000, 5), testRandom(50000, 5)
+	e1 := encode(d1, m.dictBits, uint(m.pbits), m.np)
+	e2 := encode(d2, m.dictBits, uint(m.pbits), m.np)
+	// decode in turn, to reuse pooled readers.
+	for range 3 {
+		for _, c := range []struct{ data, enc []byte }{{d1, e1}, {d2, e2}} {
+			r := NewStaticReader(bytes.NewReader(c.enc), m.dictBits, m.pbits, m.np, int64(len(c.data)))
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(c.data, got) {
+				t.Fatal("decoded data mismatch")
+			}
+			if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+				t.Fatalf("read after end should return EOF: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkStaticReader(b *testing.B) {
+	m := testMethods[0]
+	data := testText(4096, 6)
+	enc := encode(data, m.dictBits, uint(m.pbits), m.np)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	br := bytes.NewReader(enc)
+	for b.Loop() {
+		br.Reset(enc)
+		r := NewStaticReader(br, m.dictBits, m.pbits, m.np, int64(len(data)))
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package lzhuff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+)
+
+var errClosed = errors.New("lzhuff: write to closed encoder")
+
+const (
+	minMatch   = 3
+	maxMatch   = 256
+	blockLimit = 0x4000
+	hashBits   = 15
+	chainLimit = 128
+)
+
+// token is a literal (c < 256) or a match of length c-253 and offset p.
+type token struct {
+	c uint16
+	p uint16
+}
+
+type bitWriter struct {
+	buf bytes.Buffer
+	v   uint64
+	n   uint
+}
+
+func (bw *bitWriter) writeBits(v uint64, n uint) {
+	bw.v = bw.v<<n | v&(1<<n-1)
+	bw.n += n
+	for bw.n >= 8 {
+		bw.n -= 8
+		bw.buf.WriteByte(byte(bw.v >> bw.n))
+	}
+}
+
+func (bw *bitWriter) flush() []byte {
+	if bw.n > 0 {
+		bw.writeBits(0, 8-bw.n)
+	}
+	return bw.buf.Bytes()
+}
+
+// encode compresses src with static huffman for dictBits, pbits and np.
+func encode(src []byte, dictBits uint, pbits uint, np int) []byte {
+	var b bytes.Buffer
+	se := NewStaticEncoder(&b, dictBits, int(pbits), np)
+	se.Write(src)
+	se.Close()
+	return b.Bytes()
+}
+
+func pcodeOf(p uint16) int {
+	c := 0
+	for q := p; q != 0; q >>= 1 {
+		c++
+	}
+	return c
+}
+
+func writeBlock(bw *bitWriter, tokens []token, pbits uint, np int) {
+	var (
+		cfreq = make([]int, nc)
+		pfreq = make([]int, np)
+	)
+	for _, t := range tokens {
+		cfreq[t.c]++
+		if t.c >= 256 {
+			pfreq[pcodeOf(t.p)]++
+		}
+	}
+	bw.writeBits(uint64(len(tokens)), 16)
+
+	clen, croot := makeLengths(cfreq)
+	if croot >= 0 {
+		bw.writeBits(0, tbits)
+		bw.writeBits(0, tbits)
+		bw.writeBits(0, cbits)
+		bw.writeBits(uint64(croot), cbits)
+	} else {
+		tfreq := make([]int, nt)
+		countTFreq(clen, tfreq)
+		tlen, troot := makeLengths(tfreq)
+		if troot >= 0 {
+			bw.writeBits(0, tbits)
+			bw.writeBits(uint64(troot), tbits)
+		} else {
+			writePtLen(bw, tlen, tbits, 3)
+		}
+		writeCLen(bw, clen, tlen)
+	}
+
+	plen, proot := makeLengths(pfreq)
+	if proot >= 0 {
+		bw.writeBits(0, pbits)
+		bw.writeBits(uint64(proot), pbits)
+	} else {
+		writePtLen(bw, plen, pbits, -1)
+	}
+
+	ccode := makeCodes(clen)
+	pcode := makeCodes(plen)
+	for _, t := range tokens {
+		bw.writeBits(uint64(ccode[t.c]), uint(clen[t.c]))
+		if t.c < 256 {
+			continue
+		}
+		c := pcodeOf(t.p)
+		bw.writeBits(uint64(pcode[c]), uint(plen[c]))
+		if c > 1 {
+			bw.writeBits(uint64(t.p), uint(c-1))
+		}
+	}
+}
+
+func trimLens(lens []uint8) int {
+	n := len(lens)
+	for n > 0 && lens[n-1] == 0 {
+		n--
+	}
+	return n
+}
+
+func countTFreq(clen []uint8, tfreq []int) {
+	n := trimLens(clen)
+	for i := 0; i < n; {
+		k := clen[i]
+		i++
+		if k != 0 {
+			tfreq[k+2]++
+			continue
+		}
+		count := 1
+		for i < n && clen[i] == 0 {
+			i++
+			count++
+		}
+		switch {
+		case count <= 2:
+			tfreq[0] += count
+		case count <= 18:
+			tfreq[1]++
+		case count == 19:
+			tfreq[0]++
+			tfreq[1]++
+		default:
+			tfreq[2]++
+		}
+	}
+}
+
+func writePtLen(bw *bitWriter, lens []uint8, nbits uint, special int) {
+	n := trimLens(lens)
+	bw.writeBits(uint64(n), nbits)
+	for i := 0; i < n; {
+		k := lens[i]
+		i++
+		if k <= 6 {
+			bw.writeBits(uint64(k), 3)
+		} else {
+			bw.writeBits(1<<(k-3)-2, uint(k-3))
+		}
+		if i == special {
+			for i < 6 && lens[i] == 0 {
+				i++
+			}
+			bw.writeBits(uint64(i-3), 2)
+		}
+	}
+}
+
+func writeCLen(bw *bitWriter, clen, tlen []uint8) {
+	tcode := makeCodes(tlen)
+	put := func(c int) {
+		bw.writeBits(uint64(tcode[c]), uint(tlen[c]))
+	}
+	n := trimLens(clen)
+	bw.writeBits(uint64(n), cbits)
+	for i := 0; i < n; {
+		k := clen[i]
+		i++
+		if k != 0 {
+			put(int(k) + 2)
+			continue
+		}
+		count := 1
+		for i < n && clen[i] == 0 {
+			i++
+			count++
+		}
+		switch {
+		case count <= 2:
+			for j := 0; j < count; j++ {
+				put(0)
+			}
+		case count <= 18:
+			put(1)
+			bw.writeBits(uint64(count-3), 4)
+		case count == 19:
+			put(0)
+			put(1)
+			bw.writeBits(15, 4)
+		default:
+			put(2)
+			bw.writeBits(uint64(count-20), cbits)
+		}
+	}
+}
+
+// makeLengths calculates lengths of huffman codes limited to 16 bits.
+// When there is only one (or no) symbol, it returns the symbol as root.
+func makeLengths(freq []int) (lens []uint8, root int) {
+	lens = make([]uint8, len(freq))
+	var syms []int
+	for i, f := range freq {
+		if f > 0 {
+			syms = append(syms, i)
+		}
+	}
+	if len(syms) <= 1 {
+		if len(syms) == 0 {
+			return lens, 0
+		}
+		return lens, syms[0]
+	}
+	sort.SliceStable(syms, func(i, j int) bool {
+		return freq[syms[i]] < freq[syms[j]]
+	})
+
+	// build huffman tree with two queues, and measure depth of leaves.
+	n := len(syms)
+	weight := make([]int, 2*n-1)
+	parent := make([]int, 2*n-1)
+	for i, s := range syms {
+		weight[i] = freq[s]
+	}
+	leaf, node := 0, n
+	pick := func(next int) int {
+		if leaf < n && (node >= next || weight[leaf] <= weight[node]) {
+			leaf++
+			return leaf - 1
+		}
+		node++
+		return node - 1
+	}
+	for next := n; next < 2*n-1; next++ {
+		a := pick(next)
+		b := pick(next)
+		weight[next] = weight[a] + weight[b]
+		parent[a], parent[b] = next, next
+	}
+	depth := make([]int, 2*n-1)
+	var count [maxCodeLen + 1]int
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+		if i < n {
+			count[min(depth[i], maxCodeLen)]++
+		}
+	}
+
+	// adjust counts to limit lengths.
+	cum := 0
+	for i := 1; i <= maxCodeLen; i++ {
+		cum += count[i] << (maxCodeLen - i)
+	}
+	for cum != 1<<maxCodeLen {
+		count[maxCodeLen]--
+		for i := maxCodeLen - 1; i > 0; i-- {
+			if count[i] != 0 {
+				count[i]--
+				count[i+1] += 2
+				break
+			}
+		}
+		cum--
+	}
+
+	// assign longer codes to less frequent symbols.
+	k := 0
+	for l := maxCodeLen; l > 0; l-- {
+		for j := 0; j < count[l]; j++ {
+			lens[syms[k]] = uint8(l)
+			k++
+		}
+	}
+	return lens, -1
+}
+
+// makeCodes assigns canonical huffman codes.
+func makeCodes(lens []uint8) []uint16 {
+	var start [maxCodeLen + 2]uint16
+	var count [maxCodeLen + 1]uint16
+	for _, l := range lens {
+		count[l]++
+	}
+	for i := 1; i <= maxCodeLen; i++ {
+		start[i+1] = (start[i] + count[i]) << 1
+	}
+	codes := make([]uint16, len(lens))
+	for i, l := range lens {
+		if l == 0 {
+			continue
+		}
+		codes[i] = start[l]
+		start[l]++
+	}
+	return codes
+}
+
+// lookahead is size of data needed after a position to find the longest
+// match at it, and to hash all positions in the match.
+const lookahead = maxMatch + minMatch
+
+type staticEncoder struct {
+	w     io.Writer
+	pbits uint
+	pnum  int
+	bw    bitWriter
+
+	// buf holds the dictionary before pos, and data to be parsed from pos to
+	// end.  When buf gets full, the latter half is moved to the head.
+	dict     int
+	buf      []byte
+	pos, end int
+	// head is the last position for each hash, and prev is the previous
+	// position which has the same hash, for each position in the dictionary.
+	head []int32
+	prev []int32
+
+	tokens  []token
+	ntokens int64
+
+	closed bool
+	err    error
+}
+
+// NewStaticEncoder creates a new static huffman encoder, which writes
+// compressed data to w.  Data are compressed in blocks while written, with
+// memory proportional to the dictionary size.  The output is deterministic:
+// it depends only on the data and the parameters, not on GOMAXPROCS, timing
+// or how the data are split into writes.
+func NewStaticEncoder(w io.Writer, dictBits uint, pbits, pnum int) io.WriteCloser {
+	dict := 1 << dictBits
+	se := &staticEncoder{
+		w:      w,
+		pbits:  uint(pbits),
+		pnum:   pnum,
+		dict:   dict,
+		buf:    make([]byte, 2*dict+lookahead),
+		head:   make([]int32, 1<<hashBits),
+		prev:   make([]int32, dict),
+		tokens: make([]token, 0, blockLimit),
+	}
+	for i := range se.head {
+		se.head[i] = -1
+	}
+	return se
+}
+
+func (se *staticEncoder) Write(p []byte) (int, error) {
+	if se.closed {
+		return 0, errClosed
+	}
+	if se.err != nil {
+		return 0, se.err
+	}
+	nw := 0
+	for len(p) > 0 {
+		if se.end == len(se.buf) {
+			se.slide()
+		}
+		n := copy(se.buf[se.end:], p)
+		se.end += n
+		if err := se.parse(false); err != nil {
+			se.err = err
+			return nw, err
+		}
+		nw += n
+		p = p[n:]
+	}
+	return nw, nil
+}
+
+func (se *staticEncoder) Close() error {
+	if se.closed {
+		return nil
+	}
+	se.closed = true
+	if se.err != nil {
+		return se.err
+	}
+	if err := se.parse(true); err != nil {
+		return err
+	}
+	if err := se.flushBlock(); err != nil {
+		return err
+	}
+	se.bw.flush()
+	return se.flushBits()
+}
+
+// slide moves the latter half of buf to the head, and rebases positions in
+// hash chains.  pos is always beyond the first half, because buf is full and
+// data before the last lookahead are parsed.
+func (se *staticEncoder) slide() {
+	d := se.dict
+	copy(se.buf, se.buf[d:se.end])
+	se.pos -= d
+	se.end -= d
+	rebase := func(chain []int32) {
+		for i, v := range chain {
+			if int(v) < d {
+				chain[i] = -1
+			} else {
+				chain[i] = v - int32(d)
+			}
+		}
+	}
+	rebase(se.head)
+	rebase(se.prev)
+}
+
+func (se *staticEncoder) hash(i int) int {
+	b := se.buf
+	return (int(b[i])<<10 ^ int(b[i+1])<<5 ^ int(b[i+2])) & (1<<hashBits - 1)
+}
+
+func (se *staticEncoder) insert(i int) {
+	if i+minMatch <= se.end {
+		h := se.hash(i)
+		se.prev[i&(se.dict-1)] = se.head[h]
+		se.head[h] = int32(i)
+	}
+}
+
+// match finds the longest match for data at i with hash chains.
+func (se *staticEncoder) match(i int) (best, dist int) {
+	if i+minMatch > se.end {
+		return 0, 0
+	}
+	src := se.buf[:se.end]
+	limit := min(maxMatch, len(src)-i)
+	maxDist := se.dict - 1
+	for cand, n := se.head[se.hash(i)], chainLimit; cand >= 0 && n > 0; cand, n = se.prev[int(cand)&(se.dict-1)], n-1 {
+		d := i - int(cand)
+		if d > maxDist {
+			break
+		}
+		l := 0
+		for l < limit && src[int(cand)+l] == src[i+l] {
+			l++
+		}
+		if l > best {
+			best, dist = l, d
+			if l == limit {
+				break
+			}
+		}
+	}
+	return best, dist
+}
+
+// parse splits data into literals and matches, while lookahead is available
+// or final is true.  It writes a block for each blockLimit tokens.
+func (se *staticEncoder) parse(final bool) error {
+	for se.pos < se.end && (final || se.end-se.pos >= lookahead) {
+		i := se.pos
+		best, dist := se.match(i)
+		if best < minMatch {
+			se.tokens = append(se.tokens, token{c: uint16(se.buf[i])})
+			se.insert(i)
+			se.pos++
+		} else {
+			se.tokens = append(se.tokens, token{c: uint16(best - minMatch + 256), p: uint16(dist - 1)})
+			for j := i; j < i+best; j++ {
+				se.insert(j)
+			}
+			se.pos += best
+		}
+		if len(se.tokens) == blockLimit {
+			if err := se.flushBlock(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flushBlock writes a block of pending tokens.
+func (se *staticEncoder) flushBlock() error {
+	if len(se.tokens) == 0 {
+		return nil
+	}
+	writeBlock(&se.bw, se.tokens, se.pbits, se.pnum)
+	se.ntokens += int64(len(se.tokens))
+	se.tokens = se.tokens[:0]
+	return se.flushBits()
+}
+
+// flushBits writes complete bytes in the bit writer to w.
+func (se *staticEncoder) flushBits() error {
+	_, err := se.w.Write(se.bw.buf.Bytes())
+	se.bw.buf.Reset()
+	return err
+}
@@ -0,0 +1,70 @@
+package lzhuff
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"runtime"
+	"testing"
+)
+
+// TestStaticEncoderChunks checks the output doesn't depend on how the data
+// are split into writes.
+func TestStaticEncoderChunks(t *testing.T) {
+	data := append(testText(300000, 1), testRandom(100000, 2)...)
+	rnd := rand.New(rand.NewPCG(3, 4))
+	for _, m := range testMethods {
+		want := encode(data, m.dictBits, uint(m.pbits), m.np)
+		var b bytes.Buffer
+		se := NewStaticEncoder(&b, m.dictBits, m.pbits, m.np)
+		for p := data; len(p) > 0; {
+			n := min(len(p), 1+rnd.IntN(3000))
+			if _, err := se.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := se.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, b.Bytes()) {
+			t.Fatalf("%s: output depends on writes", m.name)
+		}
+		testDecode(t, m.name, NewStaticDecoder(bytes.NewReader(b.Bytes()), m.pbits, m.np), m, data)
+	}
+}
+
+// TestStaticEncoderMemory checks the encoder doesn't hold whole data, and
+// writes compressed data while written.
+func TestStaticEncoderMemory(t *testing.T) {
+	const total = 8 << 20
+	chunk := testText(64*1024, 1)
+	for _, m := range testMethods {
+		var out countWriter
+		se := NewStaticEncoder(&out, m.dictBits, m.pbits, m.np)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for range total / len(chunk) {
+			se.Write(chunk)
+		}
+		runtime.ReadMemStats(&after)
+		if out.n == 0 {
+			t.Errorf("%s: compressed data should be written before Close", m.name)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > total/4 {
+			t.Errorf("%s: too many allocations: %d bytes for %d bytes", m.name, n, total)
+		}
+		se.Close()
+	}
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+var _ io.Writer = (*countWriter)(nil)
@@ -0,0 +1,246 @@
+package lzhuff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/koron-go/lha/slide"
+)
+
+var errInvalidIndex = errors.New("lzhuff: invalid index")
+
+// indexMagic is a signature of marshaled Index.
+const indexMagic = "LZHI\x01"
+
+// Checkpoint is a state of decoding at the beginning of a block.
+type Checkpoint struct {
+	// Out is offset of decoded data.
+	Out int64
+	// Bit is offset of encoded data in bits.
+	Bit int64
+	// Window is decoded data just before Out, up to size of the dictionary.
+	Window []byte
+}
+
+// Index is a list of checkpoints, to read decoded data of static huffman
+// encoding randomly.
+type Index struct {
+	DictBits uint
+	PBits    int
+	PNum     int
+	// Size is size of decoded data.
+	Size        int64
+	Checkpoints []Checkpoint
+}
+
+// BuildIndex decodes all data from r, and builds an index which has a
+// checkpoint for each interval bytes of decoded data.  Checkpoints are placed
+// at beginnings of blocks, so actual intervals are a bit larger.
+func BuildIndex(r io.Reader, dictBits uint, pbits, pnum int, size, interval int64) (*Index, error) {
+	sd := NewStaticDecoder(r, pbits, pnum).(*staticDecoder)
+	sw := slide.NewWriter(io.Discard, dictBits)
+	idx := &Index{
+		DictBits: dictBits,
+		PBits:    pbits,
+		PNum:     pnum,
+		Size:     size,
+	}
+	var next int64
+	for sw.Len() < size {
+		if sd.nblock == 0 && sw.Len() >= next {
+			idx.Checkpoints = append(idx.Checkpoints, Checkpoint{
+				Out:    sw.Len(),
+				Bit:    sd.brd.Offset(),
+				Window: sw.Window(int(min(sw.Len(), math.MaxInt32))),
+			})
+			next = sw.Len() + interval
+		}
+		if err := decodeToken(sd, sw, 253); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// find returns the last checkpoint at or before off.
+func (idx *Index) find(off int64) *Checkpoint {
+	i := sort.Search(len(idx.Checkpoints), func(i int) bool {
+		return idx.Checkpoints[i].Out > off
+	})
+	if i == 0 {
+		return nil
+	}
+	return &idx.Checkpoints[i-1]
+}
+
+// MarshalBinary encodes the index to be persisted.
+func (idx *Index) MarshalBinary() ([]byte, error) {
+	b := []byte(indexMagic)
+	b = append(b, byte(idx.DictBits), byte(idx.PBits), byte(idx.PNum))
+	b = binary.LittleEndian.AppendUint64(b, uint64(idx.Size))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(idx.Checkpoints)))
+	for _, cp := range idx.Checkpoints {
+		b = binary.LittleEndian.AppendUint64(b, uint64(cp.Out))
+		b = binary.LittleEndian.AppendUint64(b, uint64(cp.Bit))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(cp.Window)))
+		b = append(b, cp.Window...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes the index which is encoded by MarshalBinary.
+func (idx *Index) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(indexMagic)) || len(data) < len(indexMagic)+15 {
+		return errInvalidIndex
+	}
+	d := data[len(indexMagic):]
+	v := Index{
+		DictBits: uint(d[0]),
+		PBits:    int(d[1]),
+		PNum:     int(d[2]),
+		Size:     int64(binary.LittleEndian.Uint64(d[3:])),
+	}
+	if !isStaticParams(staticParams{v.DictBits, v.PBits, v.PNum}) || v.Size < 0 {
+		return errInvalidIndex
+	}
+	n := binary.LittleEndian.Uint32(d[11:])
+	d = d[15:]
+	for i := range n {
+		if len(d) < 20 {
+			return errInvalidIndex
+		}
+		cp := Checkpoint{
+			Out: int64(binary.LittleEndian.Uint64(d)),
+			Bit: int64(binary.LittleEndian.Uint64(d[8:])),
+		}
+		wlen := binary.LittleEndian.Uint32(d[16:])
+		d = d[20:]
+		if uint64(len(d)) < uint64(wlen) {
+			return errInvalidIndex
+		}
+		// checkpoints are in order of offsets, and windows are up to size of
+		// the dictionary.
+		if cp.Out < 0 || cp.Bit < 0 || cp.Out >= v.Size || int64(wlen) > min(cp.Out, 1<<v.DictBits) {
+			return errInvalidIndex
+		}
+		if prev := v.Checkpoints; i > 0 && (cp.Out <= prev[i-1].Out || cp.Bit <= prev[i-1].Bit) {
+			return errInvalidIndex
+		}
+		cp.Window = append([]byte(nil), d[:wlen]...)
+		d = d[wlen:]
+		v.Checkpoints = append(v.Checkpoints, cp)
+	}
+	if len(d) != 0 {
+		return errInvalidIndex
+	}
+	*idx = v
+	return nil
+}
+
+// isStaticParams reports whether sp is parameters of one of static huffman
+// methods.
+func isStaticParams(sp staticParams) bool {
+	for _, m := range methods {
+		if m == sp {
+			return true
+		}
+	}
+	return false
+}
+
+// cursor is a state of decoding from a checkpoint.
+type cursor struct {
+	sd  *staticDecoder
+	sw  *slide.Writer
+	buf bytes.Buffer
+	// pos is offset of head of buf in decoded data.
+	pos int64
+	err error
+}
+
+type readerAt struct {
+	r   io.ReaderAt
+	idx *Index
+
+	mu  sync.Mutex
+	cur *cursor
+}
+
+// NewReaderAt creates a reader, which reads decoded data randomly with idx.
+// r provides encoded data.  It keeps a state of decoding, to continue
+// sequential reads without decoding from a checkpoint again.
+func NewReaderAt(r io.ReaderAt, idx *Index) io.ReaderAt {
+	return &readerAt{r: r, idx: idx}
+}
+
+func (ra *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("lzhuff: negative offset")
+	}
+	if off >= ra.idx.Size {
+		return 0, io.EOF
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	cp := ra.idx.find(off)
+	if cp == nil {
+		return 0, errInvalidIndex
+	}
+	c := ra.cur
+	// restart from the checkpoint, when the cursor is beyond off or far
+	// behind the checkpoint.
+	if c == nil || c.err != nil || c.pos > off || c.pos+int64(c.buf.Len()) < cp.Out {
+		c = ra.open(cp)
+		ra.cur = c
+	}
+	end := min(off+int64(len(p)), ra.idx.Size)
+	if err := c.fill(off, end, ra.idx.Size); err != nil {
+		return 0, err
+	}
+	c.buf.Next(int(off - c.pos))
+	n, _ := c.buf.Read(p[:end-off])
+	c.pos = off + int64(n)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// open starts decoding from a checkpoint.
+func (ra *readerAt) open(cp *Checkpoint) *cursor {
+	start := cp.Bit / 8
+	sr := io.NewSectionReader(ra.r, start, math.MaxInt64-start)
+	c := &cursor{
+		sd:  NewStaticDecoder(sr, ra.idx.PBits, ra.idx.PNum).(*staticDecoder),
+		pos: cp.Out,
+	}
+	c.sw = slide.NewWriter(&c.buf, ra.idx.DictBits)
+	c.sw.Restore(&c.buf, cp.Window, cp.Out)
+	c.err = c.sd.brd.SkipBits(uint(cp.Bit % 8))
+	return c
+}
+
+// fill decodes data until buf covers from off to end.  Data before off is
+// discarded.
+func (c *cursor) fill(off, end, size int64) error {
+	for c.err == nil && c.pos+int64(c.buf.Len()) < end {
+		if c.pos+int64(c.buf.Len()) <= off {
+			c.buf.Reset()
+			c.pos = c.sw.Len()
+		}
+		limit := min(c.sw.Len()+minFill, size)
+		c.err = c.sd.decodeTokens(c.sw, 253, limit)
+		if err := c.sw.Flush(); c.err == nil {
+			c.err = err
+		}
+	}
+	if c.err == io.EOF {
+		c.err = io.ErrUnexpectedEOF
+	}
+	return c.err
+}
@@ -0,0 +1,97 @@
+package lzhuff
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func TestIndex(t *testing.T) {
+	data := append(testText(1<<19, 3), testRandom(1<<17, 3)...)
+	for _, m := range testMethods {
+		t.Run(m.name, func(t *testing.T) {
+			enc := encode(data, m.dictBits, uint(m.pbits), m.np)
+			idx, err := BuildIndex(bytes.NewReader(enc), m.dictBits, m.pbits, m.np, int64(len(data)), 64<<10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(idx.Checkpoints) < 5 {
+				t.Fatalf("too few checkpoints: %d", len(idx.Checkpoints))
+			}
+
+			// persist and restore the index.
+			b, err := idx.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var idx2 Index
+			if err := idx2.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, idx, &idx2)
+
+			ra := NewReaderAt(bytes.NewReader(enc), &idx2)
+			rnd := rand.New(rand.NewPCG(5, 6))
+			for range 100 {
+				off := rnd.Int64N(int64(len(data)))
+				p := make([]byte, 1+rnd.IntN(10000))
+				n, err := ra.ReadAt(p, off)
+				want := data[off:min(off+int64(len(p)), int64(len(data)))]
+				if n < len(p) && err != io.EOF {
+					t.Fatalf("short read without EOF: %d %v", n, err)
+				}
+				if !bytes.Equal(want, p[:n]) {
+					t.Fatalf("data mismatch at %d", off)
+				}
+			}
+
+			// sequential read via io.SectionReader.
+			got, err := io.ReadAll(io.NewSectionReader(ra, 0, int64(len(data))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, got) {
+				t.Fatal("sequential read mismatch")
+			}
+		})
+	}
+}
+
+func TestIndex_UnmarshalInvalid(t *testing.T) {
+	var idx Index
+	for _, d := range [][]byte{nil, []byte("LZHI\x01"), []byte("XXXX\x01" + string(make([]byte, 15)))} {
+		if err := idx.UnmarshalBinary(d); err != errInvalidIndex {
+			t.Fatalf("unexpected error for %q: %v", d, err)
+		}
+	}
+
+	valid := Index{DictBits: 13, PBits: 4, PNum: 14, Size: 100000, Checkpoints: []Checkpoint{
+		{Out: 0, Bit: 0},
+		{Out: 50000, Bit: 80000, Window: make([]byte, 8192)},
+	}}
+	for name, f := range map[string]func(idx *Index){
+		"dictbits":  func(idx *Index) { idx.DictBits = 30 },
+		"pbits":     func(idx *Index) { idx.PBits = 5 },
+		"pnum":      func(idx *Index) { idx.PNum = 200 },
+		"size":      func(idx *Index) { idx.Size = -1 },
+		"out":       func(idx *Index) { idx.Checkpoints[1].Out = 0 },
+		"bit":       func(idx *Index) { idx.Checkpoints[1].Bit = 0 },
+		"outofsize": func(idx *Index) { idx.Checkpoints[1].Out = 100000 },
+		"window":    func(idx *Index) { idx.Checkpoints[1].Window = make([]byte, 8193) },
+	} {
+		v := valid
+		v.Checkpoints = append([]Checkpoint(nil), valid.Checkpoints...)
+		f(&v)
+		b, _ := v.MarshalBinary()
+		if err := idx.UnmarshalBinary(b); err != errInvalidIndex {
+			t.Fatalf("unexpected error for %s: %v", name, err)
+		}
+	}
+	b, _ := valid.MarshalBinary()
+	if err := idx.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+}
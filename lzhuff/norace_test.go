@@ -0,0 +1,5 @@
+//go:build !race
+
+package lzhuff
+
+const raceEnabled = false
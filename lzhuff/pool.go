@@ -0,0 +1,111 @@
+package lzhuff
+
+import (
+	"io"
+	"sync"
+)
+
+// staticParams is parameters of static huffman encoding.
+type staticParams struct {
+	dictBits uint
+	pbits    int
+	pnum     int
+}
+
+// staticReaderPools holds a pool of decodeReader with a static decoder, for
+// each staticParams.
+var staticReaderPools sync.Map // map[staticParams]*sync.Pool
+
+func staticReaderPool(sp staticParams) *sync.Pool {
+	if p, ok := staticReaderPools.Load(sp); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := staticReaderPools.LoadOrStore(sp, &sync.Pool{
+		New: func() any {
+			return newDecodeReader(NewStaticDecoder(nil, sp.pbits, sp.pnum), sp.dictBits, 253, 0)
+		},
+	})
+	return p.(*sync.Pool)
+}
+
+// StaticReader is a reader which decodes static huffman encoding.  It uses a
+// decoder and a window buffer from a pool, and returns them to the pool when
+// it reaches the end or an error.
+type StaticReader struct {
+	dr   *decodeReader
+	pool *sync.Pool
+	err  error
+	// in is number of bytes of encoded data consumed, and crc is CRC-16 of
+	// decoded data, at release.
+	in  int64
+	crc uint16
+}
+
+// NewStaticReader creates a reader which decodes size bytes of static
+// huffman encoding from r.
+func NewStaticReader(r io.Reader, dictBits uint, pbits, pnum int, size int64) *StaticReader {
+	sr := &StaticReader{}
+	sr.Reset(r, dictBits, pbits, pnum, size)
+	return sr
+}
+
+// Reset discards the state, and resets the reader to decode size bytes from
+// r, with the parameters.  The reader itself is reused.
+func (sr *StaticReader) Reset(r io.Reader, dictBits uint, pbits, pnum int, size int64) {
+	if sr.dr != nil {
+		sr.release()
+	}
+	pool := staticReaderPool(staticParams{dictBits, pbits, pnum})
+	dr := pool.Get().(*decodeReader)
+	d := dr.d
+	d.(Resetter).Reset(r)
+	dr.reset(d, size)
+	*sr = StaticReader{dr: dr, pool: pool}
+}
+
+func (sr *StaticReader) Read(p []byte) (int, error) {
+	if sr.dr == nil {
+		return 0, sr.err
+	}
+	n, err := sr.dr.Read(p)
+	if err == nil && sr.dr.done() {
+		// release early, because callers may not read until EOF.
+		err = io.EOF
+		if n > 0 {
+			sr.err = err
+			sr.release()
+			return n, nil
+		}
+	}
+	if err != nil {
+		sr.err = err
+		sr.release()
+	}
+	return n, err
+}
+
+// InputOffset returns number of bytes of encoded data consumed.  It is
+// valid even after the reader reaches the end.
+func (sr *StaticReader) InputOffset() int64 {
+	if sr.dr == nil {
+		return sr.in
+	}
+	return sr.dr.d.(*staticDecoder).InputOffset()
+}
+
+// CRC16 returns CRC-16 (IBM) of decoded data.  It is valid even after the
+// reader reaches the end.
+func (sr *StaticReader) CRC16() uint16 {
+	if sr.dr == nil {
+		return sr.crc
+	}
+	return sr.dr.CRC16()
+}
+
+func (sr *StaticReader) release() {
+	sr.in = sr.dr.d.(*staticDecoder).InputOffset()
+	sr.crc = sr.dr.CRC16()
+	sr.dr.d.(Resetter).Reset(nil)
+	sr.pool.Put(sr.dr)
+	sr.dr = nil
+}
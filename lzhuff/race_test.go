@@ -0,0 +1,7 @@
+//go:build race
+
+package lzhuff
+
+// raceEnabled reports whether the race detector is enabled, which makes
+// allocations.
+const raceEnabled = true
@@ -1,9 +1,11 @@
 package lzhuff
 
 import (
+	"encoding/binary"
 	"io"
 
 	"github.com/koron-go/lha/bitio"
+	"github.com/koron-go/lha/slide"
 )
 
 const (
@@ -11,6 +13,9 @@ const (
 	nc    = 510
 	tbits = 5
 	cbits = 9
+
+	// maxPBits is the maximum number of bits of P: its code and extra bits.
+	maxPBits = maxCodeLen*2 - 1
 )
 
 type staticDecoder struct {
@@ -21,20 +26,38 @@ type staticDecoder struct {
 
 	nblock int
 
+	// trees are reused for all blocks.
+	t *tree
 	c *tree
 	p *tree
 }
 
-// NewStaticDecoder creates a new static huffman decoder.
+// NewStaticDecoder creates a new static huffman decoder.  The returned
+// decoder implements Resetter.
 func NewStaticDecoder(rd io.Reader, pbits, pnum int) Decoder {
 	return &staticDecoder{
 		raw:   rd,
 		brd:   bitio.NewReader(rd),
 		pbits: pbits,
 		pnum:  pnum,
+		t:     newTree(nt, 8),
+		c:     newTree(nc, 12),
+		p:     newTree(pnum, 8),
 	}
 }
 
+// Reset discards the state, and resets the decoder to read from rd.
+func (sd *staticDecoder) Reset(rd io.Reader) {
+	sd.raw = rd
+	sd.brd.Reset(rd)
+	sd.nblock = 0
+}
+
+// InputOffset returns number of bytes of encoded data consumed.
+func (sd *staticDecoder) InputOffset() int64 {
+	return (sd.brd.Offset() + 7) / 8
+}
+
 func (sd *staticDecoder) prepareBlock() error {
 	nblock, err := sd.brd.ReadBits16(16)
 	if err != nil {
@@ -51,28 +74,14 @@ func (sd *staticDecoder) prepareBlock() error {
 }
 
 func (sd *staticDecoder) prepareC() error {
-	tt := newTree(nt, 256)
-	err := tt.readAsP(sd.brd, 5, 3)
-	if err != nil {
+	if err := sd.t.readAsP(sd.brd, tbits, 3); err != nil {
 		return err
 	}
-	tc := newTree(nc, 4096)
-	err = tc.readAsC(sd.brd, cbits, tt)
-	if err != nil {
-		return err
-	}
-	sd.c = tc
-	return nil
+	return sd.c.readAsC(sd.brd, cbits, sd.t)
 }
 
 func (sd *staticDecoder) prepareP() error {
-	tp := newTree(sd.pnum, 256)
-	err := tp.readAsP(sd.brd, sd.pbits, -1)
-	if err != nil {
-		return err
-	}
-	sd.p = tp
-	return nil
+	return sd.p.readAsP(sd.brd, sd.pbits, -1)
 }
 
 func (sd *staticDecoder) DecodeC() (code uint16, err error) {
@@ -82,7 +91,7 @@ func (sd *staticDecoder) DecodeC() (code uint16, err error) {
 		}
 	}
 	sd.nblock--
-	v, err := sd.c.decode(sd.brd, 12)
+	v, err := sd.c.decode(sd.brd)
 	if err != nil {
 		return 0, err
 	}
@@ -90,7 +99,7 @@ func (sd *staticDecoder) DecodeC() (code uint16, err error) {
 }
 
 func (sd *staticDecoder) DecodeP() (offset uint16, err error) {
-	v, err := sd.p.decode(sd.brd, 8)
+	v, err := sd.p.decode(sd.brd)
 	if err != nil {
 		return 0, err
 	}
@@ -98,9 +107,130 @@ func (sd *staticDecoder) DecodeP() (offset uint16, err error) {
 		w := v - 1
 		d, err := sd.brd.ReadBits16(uint(w))
 		if err != nil {
-			return 0, nil
+			return 0, err
 		}
 		v = (1 << w) + d
 	}
 	return v, nil
 }
+
+// decodeTokens decodes tokens and writes them to sw, until sw has limit bytes.
+// It is same as calling decodeToken repeatedly, but keeps bits of the reader
+// in local variables, and writes data to the buffer of sw directly.  Codes
+// near the end of stream are decoded by DecodeC and DecodeP, which detect it.
+func (sd *staticDecoder) decodeTokens(sw *slide.Writer, adjust uint, limit int64) error {
+	buf, pos, err := sw.Buffer()
+	if err != nil {
+		return err
+	}
+	var (
+		brd   = sd.brd
+		c, p  = sd.c, sd.p
+		v, n  = brd.Accumulator()
+		win   = sw.WindowSize()
+		start = pos
+		left  = limit - sw.Len()
+	)
+	for left > 0 {
+		if pos == len(buf) {
+			sw.Advance(pos - start)
+			if buf, pos, err = sw.Buffer(); err != nil {
+				brd.SetAccumulator(v, n)
+				return err
+			}
+			start = pos
+		}
+		if n < maxCodeLen {
+			brd.SetAccumulator(v, n)
+			brd.Refill()
+			v, n = brd.Accumulator()
+		}
+		var code int
+		if sd.nblock == 0 || n < maxCodeLen {
+			brd.SetAccumulator(v, n)
+			c, err := sd.DecodeC()
+			if err != nil {
+				sw.Advance(pos - start)
+				return err
+			}
+			v, n = brd.Accumulator()
+			code = int(c)
+		} else {
+			sd.nblock--
+			e := c.lookup(v)
+			k := uint(e>>16) & 0xff
+			v <<= k
+			n -= k
+			code = int(uint16(e))
+		}
+		if code < 256 {
+			buf[pos] = byte(code)
+			pos++
+			left--
+			continue
+		}
+		if n < maxPBits {
+			brd.SetAccumulator(v, n)
+			brd.Refill()
+			v, n = brd.Accumulator()
+		}
+		var off int
+		if n < maxPBits {
+			brd.SetAccumulator(v, n)
+			p, err := sd.DecodeP()
+			if err != nil {
+				sw.Advance(pos - start)
+				return err
+			}
+			v, n = brd.Accumulator()
+			off = int(p)
+		} else {
+			e := p.lookup(v)
+			k := uint(e>>16) & 0xff
+			v <<= k
+			n -= k
+			off = int(uint16(e))
+			if off > 0 {
+				w := uint(off - 1)
+				off = 1<<w + int(v>>(64-w))
+				v <<= w
+				n -= w
+			}
+		}
+		ln, dist := code-int(adjust), off+1
+		left -= int64(ln)
+		if dist > win || ln > len(buf)-pos {
+			// the match refers the window cyclically, or slides the window.
+			sw.Advance(pos - start)
+			if _, err := sw.WriteCopy(off, ln); err != nil {
+				brd.SetAccumulator(v, n)
+				return err
+			}
+			if buf, pos, err = sw.Buffer(); err != nil {
+				brd.SetAccumulator(v, n)
+				return err
+			}
+			start = pos
+			continue
+		}
+		st := pos - dist
+		switch {
+		case dist >= 8 && pos+ln+8 <= len(buf):
+			// copy by words, which may write garbage after the match.
+			for i := 0; i < ln; i += 8 {
+				binary.LittleEndian.PutUint64(buf[pos+i:], binary.LittleEndian.Uint64(buf[st+i:]))
+			}
+		case dist >= ln:
+			copy(buf[pos:pos+ln], buf[st:])
+		default:
+			// overlapped: copy byte by byte to repeat the pattern.
+			for i := range ln {
+				buf[pos+i] = buf[st+i]
+			}
+		}
+		pos += ln
+	}
+	sw.Advance(pos - start)
+	brd.SetAccumulator(v, n)
+	return nil
+}
@@ -6,18 +6,33 @@ import (
 	"github.com/koron-go/lha/bitio"
 )
 
+const (
+	// maxCodeLen is the maximum length of huffman codes.
+	maxCodeLen = 16
+
+	// entryLink is a flag of table entry, which indicates the entry points
+	// a sub table.
+	entryLink = 1 << 31
+)
+
+// tree is a huffman decoding table.
+//
+// It consists of a root table which is indexed by first rootBits of codes,
+// and sub tables for longer codes.  Each entry holds a symbol (or an offset
+// of sub table) in lower 16 bits, and length of code (or bits of sub table)
+// in next 8 bits.
 type tree struct {
 	l []uint16
-	v []uint16
 
-	left  []uint16
-	right []uint16
+	rootBits uint
+	bits     uint
+	table    []uint32
 }
 
-func newTree(nl int, nv int) *tree {
+func newTree(nl int, rootBits uint) *tree {
 	return &tree{
-		l: make([]uint16, nl),
-		v: make([]uint16, nv),
+		l:        make([]uint16, nl),
+		rootBits: rootBits,
 	}
 }
 
@@ -73,7 +88,7 @@ func (tr *tree) readAsP(r *bitio.Reader, bits int, special int) error {
 		tr.l[i] = 0
 		i++
 	}
-	return tr.setupTree(8)
+	return tr.setupTree()
 }
 
 // readAsC reads stream as C table.
@@ -96,7 +111,7 @@ func (tr *tree) readAsC(r *bitio.Reader, bits int, tmp *tree) error {
 		n = nl
 	}
 	for i < n {
-		c, err := tmp.decode(r, 8)
+		c, err := tmp.decode(r)
 		if err != nil {
 			return err
 		}
@@ -135,9 +150,10 @@ func (tr *tree) readAsC(r *bitio.Reader, bits int, tmp *tree) error {
 		tr.l[i] = 0
 		i++
 	}
-	return tr.setupTree(12)
+	return tr.setupTree()
 }
 
+// setup0 setups a table which decodes only a symbol with zero-length code.
 func (tr *tree) setup0(r *bitio.Reader, bits uint) error {
 	c, err := r.ReadBits16(bits)
 	if err != nil {
@@ -146,158 +162,119 @@ func (tr *tree) setup0(r *bitio.Reader, bits uint) error {
 	for i := range tr.l {
 		tr.l[i] = 0
 	}
-	for i := range tr.v {
-		tr.v[i] = c
-	}
+	tr.bits = 0
+	tr.table = append(tr.table[:0], uint32(c))
 	return nil
 }
 
-func (tr *tree) setupTree(bits int) error {
+// setupTree builds a lookup table from lengths of canonical huffman codes.
+func (tr *tree) setupTree() error {
 	var (
-		count  = make([]uint16, 17)
-		weight = make([]uint16, 17)
-		start  = make([]uint16, 17)
+		count [maxCodeLen + 1]uint32
+		start [maxCodeLen + 1]uint32
 	)
-	for i := range weight {
-		weight[i] = 1 << uint(16-i)
-	}
 
 	// count
-	for i := range tr.l {
-		if int(tr.l[i]) >= len(count) {
-			return fmt.Errorf("bad tree, length overflow: %d", tr.l[i])
+	for _, v := range tr.l {
+		if v > maxCodeLen {
+			return fmt.Errorf("bad tree, length overflow: %d", v)
 		}
-		count[tr.l[i]]++
+		count[v]++
 	}
 
-	// calculate first code
-	total := uint(0)
-	for i := 1; i < len(start); i++ {
-		start[i] = uint16(total)
-		total += uint(weight[i] * count[i])
+	// calculate first code (left aligned in 16 bits) for each length.
+	total := uint32(0)
+	for i := 1; i <= maxCodeLen; i++ {
+		start[i] = total
+		total += count[i] << (maxCodeLen - i)
 	}
-	if total != 0x10000 {
+	if total != 1<<maxCodeLen {
 		return fmt.Errorf("bad tree, total unexpected: %04x", total)
 	}
 
-	// shift data to make table
-	m := uint(16 - bits)
-	for i := 1; i <= bits; i++ {
-		start[i] >>= m
-		weight[i] >>= m
+	var (
+		rb   = tr.rootBits
+		size = uint32(1) << rb
+	)
+	tr.bits = rb
+	if cap(tr.table) < int(size) {
+		tr.table = make([]uint32, size)
+	}
+	tr.table = tr.table[:size]
+	for i := range tr.table {
+		tr.table[i] = 0
 	}
 
-	j := start[bits+1] >> m
-	k := 1 << uint(bits)
-	if k > 4096 {
-		k = 4096
+	// determine bits of sub tables for codes longer than root bits.
+	sub := start
+	for _, v := range tr.l {
+		if uint(v) <= rb {
+			continue
+		}
+		code := sub[v]
+		sub[v] += 1 << (maxCodeLen - v)
+		prefix := code >> (maxCodeLen - rb)
+		sb := uint32(uint(v) - rb)
+		if (tr.table[prefix]>>16)&0xff < sb {
+			tr.table[prefix] = entryLink | sb<<16
+		}
 	}
-	if j != 0 {
-		for i := int(j); i < k; i++ {
-			tr.v[i] = 0
+
+	// allocate sub tables.
+	for i := range size {
+		e := tr.table[i]
+		if e&entryLink == 0 {
+			continue
 		}
+		sb := (e >> 16) & 0xff
+		off := uint32(len(tr.table))
+		tr.table[i] = entryLink | sb<<16 | off
+		tr.table = append(tr.table, make([]uint32, 1<<sb)...)
 	}
 
-	// create tree
-	var (
-		avail = uint16(len(tr.l))
-		vp    *uint16
-		left  = make([]uint16, 4096)
-		right = make([]uint16, 4096)
-	)
+	// fill entries.
 	for i, v := range tr.l {
 		if v == 0 {
 			continue
 		}
-		c := start[v] + weight[v]
-		if int(v) <= bits {
-			// code in array
-			if c > 4096 {
-				c = 4096
-			}
-			for j := start[v]; j < c; j++ {
-				tr.v[j] = uint16(i)
+		code := start[v]
+		start[v] += 1 << (maxCodeLen - v)
+		e := uint32(i) | uint32(v)<<16
+		if uint(v) <= rb {
+			first := code >> (maxCodeLen - rb)
+			n := uint32(1) << (rb - uint(v))
+			for j := first; j < first+n; j++ {
+				tr.table[j] = e
 			}
-		} else {
-			// code not in array
-			x := start[v]
-			if x>>m > 4096 {
-				return fmt.Errorf("bad tree, big start: %d %d %d", i, v, x)
-			}
-			vp = &tr.v[x>>m]
-			x <<= uint(bits)
-			for n := int(v) - bits; n > 0; n-- {
-				if *vp == 0 {
-					left[avail] = 0
-					right[avail] = 0
-					*vp = avail
-					avail++
-				}
-				if (x & 0x8000) != 0 {
-					vp = &right[*vp]
-				} else {
-					vp = &left[*vp]
-				}
-				x <<= 1
-			}
-			*vp = uint16(i)
+			continue
+		}
+		link := tr.table[code>>(maxCodeLen-rb)]
+		sb := uint((link >> 16) & 0xff)
+		off := link & 0xffff
+		first := off + (code>>(maxCodeLen-rb-sb))&(1<<sb-1)
+		n := uint32(1) << (rb + sb - uint(v))
+		for j := first; j < first+n; j++ {
+			tr.table[j] = e
 		}
-
-		start[v] = c
 	}
-
-	tr.left = left
-	tr.right = right
 	return nil
 }
 
-func (tr *tree) decode(r *bitio.Reader, bits uint) (uint16, error) {
-	c0, err := r.PeekBits(bits)
-	if err != nil {
-		return 0, err
-	}
-	if int(c0) >= len(tr.v) {
-		return 0, fmt.Errorf("c0 overflow: %d >= %d", c0, len(tr.v))
-	}
-	c := tr.v[c0]
-
-	// when hits tr.l array.
-	if int(c) < len(tr.l) {
-		err := r.SkipBits(uint(tr.l[c]))
-		if err != nil {
-			return 0, err
-		}
-		return c, nil
-	}
-
-	err = r.SkipBits(bits)
-	if err != nil {
-		return 0, nil
+// lookup returns the table entry for a code at MSB of v.
+func (tr *tree) lookup(v uint64) uint32 {
+	e := tr.table[v>>(64-tr.bits)]
+	if e&entryLink != 0 {
+		sb := uint(e>>16) & 0xff
+		e = tr.table[e&0xffff+uint32(v>>(64-tr.bits-sb))&(1<<sb-1)]
 	}
+	return e
+}
 
-	for int(c) >= len(tr.l) {
-		b, err := r.ReadBit()
-		if err != nil {
-			return 0, err
-		}
-		if b {
-			if int(c) >= len(tr.right) {
-				return 0, fmt.Errorf("over right: %d >= %d", c, len(tr.right))
-			}
-			c = tr.right[c]
-		} else {
-			if int(c) >= len(tr.left) {
-				return 0, fmt.Errorf("over left: %d >= %d", c, len(tr.left))
-			}
-			c = tr.left[c]
-		}
-		if int(c) >= len(tr.left) {
-			return 0, fmt.Errorf("over left: %d >= %d", c, len(tr.left))
-		}
-		if c == tr.left[c] {
-			break
-		}
+// decode reads a code from r and returns its symbol.
+func (tr *tree) decode(r *bitio.Reader) (uint16, error) {
+	e := tr.lookup(r.Lookahead(maxCodeLen) << (64 - maxCodeLen))
+	if err := r.SkipBits(uint(e>>16) & 0xff); err != nil {
+		return 0, err
 	}
-
-	return c, nil
+	return uint16(e), nil
 }
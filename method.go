@@ -1,125 +1,136 @@
 package lha
 
 import (
-	"fmt"
+	"errors"
 	"io"
+	"sync"
 
-	"github.com/koron-go/lha/crc16"
 	"github.com/koron-go/lha/lzhuff"
 )
 
-type huffDecoderFactory func(r io.Reader) lzhuff.Decoder
-
-type method struct {
-	dictBits       uint
-	adjust         uint
-	decoderFactory huffDecoderFactory
-}
-
-var methods = map[string]*method{
-	"-lh0-": {
-		dictBits: 0,
-		adjust:   253,
-		decoderFactory: func(r io.Reader) lzhuff.Decoder {
-			// use copyRaw() to extract raw data.
-			return nil
-		},
-	},
-	"-lh4-": {
-		dictBits: 12,
-		adjust:   253,
-		decoderFactory: func(r io.Reader) lzhuff.Decoder {
-			return lzhuff.NewStaticDecoder(r, 4, 14)
-		},
-	},
-	"-lh5-": {
-		dictBits: 13,
-		adjust:   253,
-		decoderFactory: func(r io.Reader) lzhuff.Decoder {
-			return lzhuff.NewStaticDecoder(r, 4, 14)
-		},
-	},
-	"-lh6-": {
-		dictBits: 15,
-		adjust:   253,
-		decoderFactory: func(r io.Reader) lzhuff.Decoder {
-			return lzhuff.NewStaticDecoder(r, 5, 16)
-		},
-	},
-	"-lh7-": {
-		dictBits: 16,
-		adjust:   253,
-		decoderFactory: func(r io.Reader) lzhuff.Decoder {
-			return lzhuff.NewStaticDecoder(r, 5, 17)
-		},
-	},
-}
-
-// TODO: implement these methods.
-//var unsupportedMethods = map[string]*method{
-//	"-lh1-": {
-//		dictBits: 12,
-//		adjust:   253,
-//	},
-//	"-lh2-": {
-//		dictBits: 13,
-//		adjust:   253,
-//	},
-//	"-lh3-": {
-//		dictBits: 13,
-//		adjust:   253,
-//	},
-//	"-lzs-": {
-//		dictBits: 11,
-//		adjust:   254,
-//	},
-//	"-lz5-": {
-//		dictBits: 12,
-//		adjust:   253,
-//	},
-//	"-lz4-": {
-//		dictBits: 0,
-//		adjust:   253,
-//	},
-//	"-pm0-": {
-//		dictBits: 0,
-//		adjust:   253,
-//	},
-//	"-pm2-": {
-//		dictBits: 13,
-//		adjust:   254,
-//	},
-//	// FIXME: need somehthing special.
-//	"-lhd-": {
-//		adjust: 253,
-//	},
-//}
-
-func getMethod(s string) (*method, error) {
-	m, ok := methods[s]
+// Decompressor returns a reader which decompresses data read from r.
+// originalSize is size of the decompressed data.  Errors of decompression
+// should be reported by Read of the returned reader.
+type Decompressor func(r io.Reader, originalSize int64) io.Reader
+
+// Compressor returns a writer which compresses data written to it, and
+// writes compressed data to w.  Close of the returned writer must flush
+// remaining data, but must not close w.
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	decompressors sync.Map // map[string]Decompressor
+	compressors   sync.Map // map[string]Compressor
+)
+
+// staticMethod is parameters of a static huffman method.
+type staticMethod struct {
+	dictBits uint
+	pbits    int
+	pnum     int
+}
+
+var staticMethods = map[string]staticMethod{
+	"-lh4-": {12, 4, 14},
+	"-lh5-": {13, 4, 14},
+	"-lh6-": {15, 5, 16},
+	"-lh7-": {16, 5, 17},
+}
+
+func init() {
+	decompressors.Store("-lh0-", Decompressor(decompressStored))
+	decompressors.Store("-lhd-", Decompressor(decompressStored))
+	compressors.Store("-lh0-", Compressor(compressStored))
+	compressors.Store("-lhd-", Compressor(compressDir))
+	for name, m := range staticMethods {
+		decompressors.Store(name, staticDecompressor(m.dictBits, m.pbits, m.pnum))
+		compressors.Store(name, staticCompressor(m.dictBits, m.pbits, m.pnum))
+	}
+}
+
+// TODO: support -lh1-, -lh2-, -lh3-, -lzs-, -lz5-, -lz4-, -pm0- and -pm2-.
+
+// RegisterDecompressor registers a decompressor for a method, like
+// "-lh5-".  It panics if the method is already registered.  Use
+// Reader.RegisterDecompressor to override the built-in methods.
+func RegisterDecompressor(method string, dcomp Decompressor) {
+	if _, dup := decompressors.LoadOrStore(method, dcomp); dup {
+		panic("lha: decompressor already registered: " + method)
+	}
+}
+
+// RegisterCompressor registers a compressor for a method, like "-lh5-".  It
+// panics if the method is already registered.  Use Writer.RegisterCompressor
+// to override the built-in methods.
+func RegisterCompressor(method string, comp Compressor) {
+	if _, dup := compressors.LoadOrStore(method, comp); dup {
+		panic("lha: compressor already registered: " + method)
+	}
+}
+
+func decompressor(method string) Decompressor {
+	v, ok := decompressors.Load(method)
+	if !ok {
+		return nil
+	}
+	return v.(Decompressor)
+}
+
+func compressor(method string) Compressor {
+	v, ok := compressors.Load(method)
 	if !ok {
-		return nil, fmt.Errorf("unsupported method: %s", s)
+		return nil
 	}
-	return m, nil
+	return v.(Compressor)
+}
+
+func decompressStored(r io.Reader, originalSize int64) io.Reader {
+	return io.LimitReader(r, originalSize)
 }
 
-func (m *method) decode(r io.Reader, w io.Writer, size int) (n int, crc uint16, err error) {
-	hd := m.decoderFactory(r)
-	if hd == nil {
-		return m.copyRaw(r, w, size)
+// staticDecompressor returns a decompressor for static huffman methods
+// (-lh4- to -lh7-).
+func staticDecompressor(dictBits uint, pbits, pnum int) Decompressor {
+	return func(r io.Reader, originalSize int64) io.Reader {
+		return lzhuff.NewStaticReader(r, dictBits, pbits, pnum, originalSize)
 	}
-	n, crc, err = lzhuff.Decode(hd, w, m.dictBits, m.adjust, size)
-	if err != nil {
-		return n, 0, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func compressStored(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+var errDirHasData = errors.New("lha: directory can't have data")
+
+type dirWriter struct{}
+
+func (dirWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		return 0, errDirHasData
 	}
-	return n, crc, nil
+	return 0, nil
+}
+
+func (dirWriter) Close() error {
+	return nil
+}
+
+func compressDir(io.Writer) (io.WriteCloser, error) {
+	return dirWriter{}, nil
 }
 
-func (m *method) copyRaw(r io.Reader, w io.Writer, size int) (n int, crc uint16, err error) {
-	hash := crc16.NewIBM()
-	n64, err := io.CopyN(io.MultiWriter(hash, w), r, int64(size))
-	if err != nil {
-		return int(n64), 0, err
+// staticCompressor returns a compressor for static huffman methods (-lh4-
+// to -lh7-).
+func staticCompressor(dictBits uint, pbits, pnum int) Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return lzhuff.NewStaticEncoder(w, dictBits, pbits, pnum), nil
 	}
-	return int(n64), hash.Sum16(), nil
 }
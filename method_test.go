@@ -0,0 +1,124 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testWriteArchive(t *testing.T, w *Writer, method string, data []byte) {
+	t.Helper()
+	fw, err := w.CreateHeader(&Header{Method: method, Name: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMethods_RoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("Hello LHA, good-bye LHA. ", 1000))
+	for _, method := range []string{"-lh0-", "-lh4-", "-lh5-", "-lh6-", "-lh7-"} {
+		t.Run(method, func(t *testing.T) {
+			var b bytes.Buffer
+			testWriteArchive(t, NewWriter(&b), method, data)
+			headers, bodies := testReadAll(t, b.Bytes())
+			assert.Equal(t, method, headers[0].Method)
+			if method != "-lh0-" && headers[0].PackedSize >= uint64(len(data)) {
+				t.Fatalf("not compressed: %d", headers[0].PackedSize)
+			}
+			if !bytes.Equal(data, bodies[0]) {
+				t.Fatal("decoded data mismatch")
+			}
+		})
+	}
+}
+
+type xorWriter struct {
+	w io.Writer
+}
+
+func (x xorWriter) Write(p []byte) (int, error) {
+	q := make([]byte, len(p))
+	for i, c := range p {
+		q[i] = c ^ 0x55
+	}
+	return x.w.Write(q)
+}
+
+func (xorWriter) Close() error { return nil }
+
+type xorReader struct {
+	r io.Reader
+}
+
+func (x xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0x55
+	}
+	return n, err
+}
+
+func xorCompressor(w io.Writer) (io.WriteCloser, error) {
+	return xorWriter{w}, nil
+}
+
+func xorDecompressor(r io.Reader, size int64) io.Reader {
+	return xorReader{io.LimitReader(r, size)}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	RegisterCompressor("-xor-", xorCompressor)
+	RegisterDecompressor("-xor-", xorDecompressor)
+	data := []byte("Hello LHA\n")
+	var b bytes.Buffer
+	testWriteArchive(t, NewWriter(&b), "-xor-", data)
+	if bytes.Contains(b.Bytes(), data) {
+		t.Fatal("data should be transformed by compressor")
+	}
+	_, bodies := testReadAll(t, b.Bytes())
+	assert.Equal(t, data, bodies[0])
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicated registration should panic")
+		}
+	}()
+	RegisterDecompressor("-lh5-", xorDecompressor)
+}
+
+func TestOverrideDecompressor(t *testing.T) {
+	data := []byte("Hello LHA\n")
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.RegisterCompressor("-lh5-", xorCompressor)
+	testWriteArchive(t, w, "-lh5-", data)
+
+	r := NewReader(bytes.NewReader(b.Bytes()))
+	r.RegisterDecompressor("-lh5-", xorDecompressor)
+	if _, err := r.NextHeader(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := r.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, data, out.Bytes())
+
+	// default decompressor fails to decode.
+	r = NewReader(bytes.NewReader(b.Bytes()))
+	if _, err := r.NextHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Decode(io.Discard); err == nil {
+		t.Fatal("decode with built-in -lh5- should fail")
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package lha
+
+const raceEnabled = false
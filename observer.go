@@ -0,0 +1,14 @@
+package lha
+
+// Observer observes progress of decoding entries.
+type Observer interface {
+	// StartEntry is called before decoding an entry.
+	StartEntry(h *Header)
+
+	// Progress is called while decoding an entry, with bytes of packed
+	// data read (in) and bytes of decoded data written (out) so far.
+	Progress(h *Header, in, out int64)
+
+	// EndEntry is called after decoding an entry, with the result.
+	EndEntry(h *Header, err error)
+}
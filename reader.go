@@ -2,13 +2,17 @@ package lha
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/lzhuff"
 )
 
 const (
@@ -18,6 +22,7 @@ const (
 var (
 	errTooShortExtendedHeader = errors.New("too short extended header")
 	errHeaderCRCMismatch      = errors.New("header CRC mismatch")
+	errHeaderSumMismatch      = errors.New("header checksum mismatch")
 	errBodyCRCMismatch        = errors.New("body CRC mismatch")
 
 	errNilHeader = errors.New("no header prepared: try NextHeader() first")
@@ -30,8 +35,42 @@ type Reader struct {
 	err error
 	cnt uint64
 	crc crc16.Hash16
+	sum uint8
+
+	// headerSum is checksum of level 0 and 1 header.
+	headerSum uint8
+	// headerCRC is CRC16 of whole header.
+	headerCRC uint16
 
 	curr *Header
+
+	// base is offset where cnt started to count.  headerOffset is offset of
+	// the last header, and bodyOffset is offset of packed data of it.
+	base         int64
+	headerOffset int64
+	bodyOffset   int64
+
+	decompressors map[string]Decompressor
+	observer      Observer
+	location      *time.Location
+
+	// scratch is a buffer to read numbers in headers.  arena and extras are
+	// chunks from which small data and Extra of headers are allocated.
+	scratch [8]byte
+	arena   []byte
+	extras  []ExtendedHeader
+
+	// lr and static are reused to decode each file.
+	lr     io.LimitedReader
+	static *lzhuff.StaticReader
+}
+
+// ReaderOptions is options for Reader.
+type ReaderOptions struct {
+	// Location is a location of DOS timestamps in headers of level 0 and 1.
+	// Other times in headers are presented in it too.  time.Local is used
+	// when it is nil.
+	Location *time.Location
 }
 
 // NewReader creates LHA archive reader.
@@ -43,6 +82,54 @@ func NewReader(r io.Reader) *Reader {
 	}
 }
 
+// NewReaderWithOptions creates LHA archive reader with opts.
+func NewReaderWithOptions(r io.Reader, opts *ReaderOptions) *Reader {
+	lr := NewReader(r)
+	if opts != nil {
+		lr.location = opts.Location
+	}
+	return lr
+}
+
+// Reset discards the state, and resets the reader to read an archive from
+// rd.  It reuses buffers, and keeps registered decompressors, the observer
+// and options.
+func (r *Reader) Reset(rd io.Reader) {
+	r.raw = rd
+	r.br.Reset(rd)
+	r.err = nil
+	r.cnt = 0
+	r.crc.Reset()
+	r.sum = 0
+	r.headerSum = 0
+	r.headerCRC = 0
+	r.curr = nil
+	r.base = 0
+	r.headerOffset = 0
+	r.bodyOffset = 0
+}
+
+// RegisterDecompressor registers or overrides a decompressor for a method,
+// only for this reader.
+func (r *Reader) RegisterDecompressor(method string, dcomp Decompressor) {
+	if r.decompressors == nil {
+		r.decompressors = map[string]Decompressor{}
+	}
+	r.decompressors[method] = dcomp
+}
+
+func (r *Reader) decompressor(method string) Decompressor {
+	if dcomp, ok := r.decompressors[method]; ok {
+		return dcomp
+	}
+	return decompressor(method)
+}
+
+// SetObserver sets an observer, which is notified progress of decoding.
+func (r *Reader) SetObserver(o Observer) {
+	r.observer = o
+}
+
 // CRC16 returns current CRC16 value.
 func (r *Reader) CRC16() uint16 {
 	return r.crc.Sum16()
@@ -50,6 +137,19 @@ func (r *Reader) CRC16() uint16 {
 
 // NextHeader reads a next file header.
 func (r *Reader) NextHeader() (h *Header, err error) {
+	h, err = r.nextHeader()
+	if err != nil || h == nil {
+		return nil, err
+	}
+	if err := r.verifyHeader(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// nextHeader reads a next file header without verification.  The header is
+// prepared to be decoded or skipped, even if it is broken.
+func (r *Reader) nextHeader() (h *Header, err error) {
 	if r.err != nil {
 		return nil, r.err
 	}
@@ -66,49 +166,63 @@ func (r *Reader) NextHeader() (h *Header, err error) {
 	if !ok {
 		return nil, fmt.Errorf("unknown header level: %d", lv)
 	}
+	r.base += int64(r.cnt)
+	r.headerOffset = r.base
 	r.cnt = 0
 	r.crc.Reset()
-	h, err = proc(r)
-	if err != nil {
+	// allocate the header and its copy for the reader at once.
+	hs := new([2]Header)
+	h = &hs[0]
+	if err := proc(r, h); err != nil {
 		return nil, err
 	}
-	if h.HeaderCRC != nil && *h.HeaderCRC != r.crc.Sum16() {
-		return nil, errHeaderCRCMismatch
+	if r.location != nil {
+		h.inLocation(r.location)
 	}
+	r.headerCRC = r.crc.Sum16()
+	r.base += int64(r.cnt)
+	r.bodyOffset = r.base
 	r.cnt = 0
-	r.curr = new(Header)
+	r.curr = &hs[1]
 	*r.curr = *h
 	return h, nil
 }
 
-func (r *Reader) remainToNext() int {
+// verifyHeader verifies checksum or CRC of the header which read last.
+func (r *Reader) verifyHeader(h *Header) error {
+	if (h.Level == 0 || h.Level == 1) && h.Sum != r.headerSum {
+		return errHeaderSumMismatch
+	}
+	if h.HeaderCRC != nil && *h.HeaderCRC != r.headerCRC {
+		return errHeaderCRCMismatch
+	}
+	return nil
+}
+
+func (r *Reader) remainToNext() int64 {
 	if r.curr == nil {
 		return 0
 	}
-	var remain uint64
-	switch r.curr.Level {
-	case 1:
-		if r.curr.PackedSize > r.cnt+r.curr.ExtendedHeaderSize {
-			remain = r.curr.PackedSize - r.cnt - r.curr.ExtendedHeaderSize
-		}
-	default:
-		if r.curr.PackedSize > r.cnt {
-			remain = r.curr.PackedSize - r.cnt
-		}
+	if size := r.curr.bodySize(); size > r.cnt {
+		return int64(size - r.cnt)
 	}
-	// FIXME: Consider the possibility of int overflow in a 32-bit env.
-	return int(remain)
+	return 0
+}
+
+// discard skips n bytes of packed data.
+func (r *Reader) discard(n int64) error {
+	var m int64
+	m, r.err = io.CopyN(io.Discard, r.br, n)
+	r.cnt += uint64(m)
+	return r.err
 }
 
 // seekNext moves the cursor to the beginning of the next header.
 func (r *Reader) seekNext() error {
-	remain := r.remainToNext()
-	if remain <= 0 {
-		return nil
-	}
-	_, r.err = r.br.Discard(remain)
-	if r.err != nil {
-		return r.err
+	if remain := r.remainToNext(); remain > 0 {
+		if err := r.discard(remain); err != nil {
+			return err
+		}
 	}
 	r.curr = nil
 	return nil
@@ -138,26 +252,79 @@ func (r *Reader) skip(n int) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
-	var d []byte
-	d, r.err = r.readBytes(n)
-	if r.err != nil {
-		return 0, r.err
+	buf := make([]byte, min(n, maxPrealloc))
+	for m := 0; m < n; {
+		d := buf[:min(n-m, len(buf))]
+		if _, r.err = io.ReadFull(r.br, d); r.err != nil {
+			return m, r.err
+		}
+		r.account(d)
+		m += len(d)
 	}
-	return len(d), nil
+	return n, nil
+}
+
+// maxPrealloc is the maximum size of a buffer allocated before reading data.
+// Larger data are read into a growing buffer, so a broken size in a header
+// can't allocate huge memory.
+const maxPrealloc = 64 * 1024
+
+// arenaSize is size of a chunk, from which small data in headers are
+// allocated.  Headers keep the data, so a chunk is never reused.
+const arenaSize = 4096
+
+const (
+	// extrasSize is number of extended headers in a chunk, and
+	// maxSharedExtras is the maximum number of them used by a header.
+	extrasSize      = 256
+	maxSharedExtras = 16
+)
+
+// alloc returns a byte slice of n bytes.  Small ones are carved from the
+// arena, to reduce allocations for each header.
+func (r *Reader) alloc(n int) []byte {
+	if n > arenaSize/16 {
+		return make([]byte, n)
+	}
+	if len(r.arena) < n {
+		r.arena = make([]byte, arenaSize)
+	}
+	d := r.arena[:n:n]
+	r.arena = r.arena[n:]
+	return d
 }
 
 func (r *Reader) readBytes(n int) ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
-	d := make([]byte, n)
-	_, r.err = io.ReadFull(r.br, d)
+	var d []byte
+	if n <= maxPrealloc {
+		d = r.alloc(n)
+		_, r.err = io.ReadFull(r.br, d)
+	} else {
+		var b bytes.Buffer
+		var m int64
+		m, r.err = io.CopyN(&b, r.br, int64(n))
+		if r.err == io.EOF && m > 0 {
+			r.err = io.ErrUnexpectedEOF
+		}
+		d = b.Bytes()
+	}
 	if r.err != nil {
 		return nil, r.err
 	}
+	r.account(d)
+	return d, nil
+}
+
+// account counts read bytes, and updates CRC and checksum.
+func (r *Reader) account(d []byte) {
 	r.cnt += uint64(len(d))
 	r.crc.Write(d)
-	return d, nil
+	for _, b := range d {
+		r.sum += b
+	}
 }
 
 func (r *Reader) readStringN(n int) (string, error) {
@@ -168,6 +335,30 @@ func (r *Reader) readStringN(n int) (string, error) {
 	return string(d), nil
 }
 
+// knownMethods is names of methods, which are read without allocation.
+var knownMethods = []string{
+	"-lh0-", "-lh1-", "-lh2-", "-lh3-", "-lh4-", "-lh5-", "-lh6-", "-lh7-",
+	"-lhd-", "-lzs-", "-lz4-", "-lz5-", "-pm0-", "-pm2-",
+}
+
+// readMethod reads a name of method.
+func (r *Reader) readMethod() (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	d := r.scratch[:5]
+	if _, r.err = io.ReadFull(r.br, d); r.err != nil {
+		return "", r.err
+	}
+	r.account(d)
+	for _, m := range knownMethods {
+		if string(d) == m {
+			return m, nil
+		}
+	}
+	return string(d), nil
+}
+
 func (r *Reader) readUint8() (uint8, error) {
 	if r.err != nil {
 		return 0, r.err
@@ -177,8 +368,8 @@ func (r *Reader) readUint8() (uint8, error) {
 		r.err = err
 		return 0, r.err
 	}
-	r.cnt++
-	r.crc.Write([]byte{b0})
+	r.scratch[0] = b0
+	r.account(r.scratch[:1])
 	return uint8(b0), nil
 }
 
@@ -192,8 +383,8 @@ func (r *Reader) readUint16() (uint16, error) {
 		r.err = err
 		return 0, r.err
 	}
-	r.cnt += 2
-	r.crc.Write([]byte{b0, b1})
+	r.scratch[0], r.scratch[1] = b0, b1
+	r.account(r.scratch[:2])
 	return uint16(b1)<<8 + uint16(b0), nil
 }
 
@@ -207,11 +398,37 @@ func (r *Reader) readUint16NoCRC() (uint16, error) {
 		r.err = err
 		return 0, r.err
 	}
-	r.cnt += 2
-	r.crc.Write([]byte{0, 0})
+	r.scratch[0], r.scratch[1] = 0, 0
+	r.account(r.scratch[:2])
 	return uint16(b1)<<8 + uint16(b0), nil
 }
 
+// readHeaderCRCBytes reads payload of header CRC extended header.  The CRC
+// field is treated as zero to calculate CRC of the header.
+func (r *Reader) readHeaderCRCBytes(n int) ([]byte, error) {
+	if n < 2 {
+		return r.readBytes(n)
+	}
+	v, err := r.readUint16NoCRC()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxPrealloc {
+		d, err := r.readBytes(n - 2)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{byte(v), byte(v >> 8)}, d...), nil
+	}
+	d := r.alloc(n)
+	binary.LittleEndian.PutUint16(d, v)
+	if _, r.err = io.ReadFull(r.br, d[2:]); r.err != nil {
+		return nil, r.err
+	}
+	r.account(d[2:])
+	return d, nil
+}
+
 func (r *Reader) readUint32() (uint32, error) {
 	if r.err != nil {
 		return 0, r.err
@@ -226,8 +443,8 @@ func (r *Reader) readUint32() (uint32, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
-	r.cnt += 4
-	r.crc.Write([]byte{b0, b1, b2, b3})
+	r.scratch[0], r.scratch[1], r.scratch[2], r.scratch[3] = b0, b1, b2, b3
+	r.account(r.scratch[:4])
 	return uint32(b3)<<24 + uint32(b2)<<16 + uint32(b1)<<8 + uint32(b0), nil
 }
 
@@ -235,12 +452,11 @@ func (r *Reader) readUint64() (uint64, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
-	d, err := r.readBytes(8)
-	if err != nil {
-		return 0, err
+	d := r.scratch[:8]
+	if _, r.err = io.ReadFull(r.br, d); r.err != nil {
+		return 0, r.err
 	}
-	r.cnt += uint64(len(d))
-	r.crc.Write(d)
+	r.account(d)
 	return binary.LittleEndian.Uint64(d), nil
 }
 
@@ -257,30 +473,135 @@ func (r *Reader) readTime() (time.Time, error) {
 }
 
 // Decode decodes a file to w.  It returns decoded size and error.
-func (r *Reader) Decode(w io.Writer) (decoded int, err error) {
-	if r.curr == nil {
-		return 0, errNilHeader
+func (r *Reader) Decode(w io.Writer) (decoded int64, err error) {
+	return r.DecodeContext(context.Background(), w)
+}
+
+// DecodeContext decodes a file to w, like Decode.  It checks cancellation of
+// ctx for each chunk of decoded data, and reports progress to the observer.
+func (r *Reader) DecodeContext(ctx context.Context, w io.Writer) (decoded int64, err error) {
+	decoded, _, err = r.decode(ctx, w)
+	return decoded, err
+}
+
+// inputOffsetter is a reader of decompressed data, which reports number of
+// bytes of packed data consumed.
+type inputOffsetter interface {
+	InputOffset() int64
+}
+
+// newDecompressReader returns a reader which decompresses data of method read
+// from lr.  Readers of built-in static huffman methods are reused, unless
+// decompressors for them are registered to r.
+func (r *Reader) newDecompressReader(method string, lr *io.LimitedReader, size int64) (io.Reader, error) {
+	if m, ok := staticMethods[method]; ok && r.decompressors[method] == nil {
+		if r.static == nil {
+			r.static = lzhuff.NewStaticReader(lr, m.dictBits, m.pbits, m.pnum, size)
+		} else {
+			r.static.Reset(lr, m.dictBits, m.pbits, m.pnum, size)
+		}
+		return r.static, nil
 	}
-	m, err := getMethod(r.curr.Method)
-	if err != nil {
-		return 0, err
+	dcomp := r.decompressor(method)
+	if dcomp == nil {
+		return nil, fmt.Errorf("unsupported method: %s", method)
 	}
-	lr := &io.LimitedReader{
-		R: r.br,
-		N: int64(r.curr.PackedSize),
+	return dcomp(lr, size), nil
+}
+
+// decode decodes a file to w.  It returns number of bytes of packed data
+// consumed by the decompressor, in addition to decoded bytes.
+func (r *Reader) decode(ctx context.Context, w io.Writer) (decoded, consumed int64, err error) {
+	if r.curr == nil {
+		return 0, 0, errNilHeader
 	}
 	h := r.curr
-	defer func() {
-		// count read length.
-		r.cnt += h.PackedSize - uint64(lr.N)
-	}()
-	n, crc, err := m.decode(lr, w, int(r.curr.OriginalSize))
+	if r.observer != nil {
+		r.observer.StartEntry(h)
+		defer func() {
+			r.observer.EndEntry(h, err)
+		}()
+	}
+	lr := &r.lr
+	*lr = io.LimitedReader{
+		R: r.br,
+		N: int64(h.bodySize()),
+	}
+	size := int64(h.OriginalSize)
+	rd, err := r.newDecompressReader(h.Method, lr, size)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
+	}
+	// use CRC of the static huffman reader of lzhuff, which calculates it
+	// while decoding.  Other decompressors are not trusted to verify data.
+	var sum16 func() uint16
+	if sr, ok := rd.(*lzhuff.StaticReader); ok {
+		sum16 = sr.CRC16
+	} else {
+		hash := crc16.NewIBM()
+		w = io.MultiWriter(w, hash)
+		sum16 = hash.Sum16
+	}
+	n, err := copyContext(ctx, w, rd, size, func(n int64) {
+		if r.observer != nil {
+			r.observer.Progress(h, int64(h.bodySize())-lr.N, n)
+		}
+	})
+	// count read length.
+	consumed = int64(h.bodySize()) - lr.N
+	r.cnt += uint64(consumed)
+	if oi, ok := rd.(inputOffsetter); ok {
+		consumed = oi.InputOffset()
 	}
-	if crc != r.curr.CRC {
-		return 0, errBodyCRCMismatch
+	if err != nil {
+		return n, consumed, err
+	}
+	if sum16() != h.CRC {
+		return n, consumed, errBodyCRCMismatch
+	}
+	// skip rest of packed data, to be ready for next header.
+	if err := r.seekNext(); err != nil {
+		return n, consumed, err
+	}
+	return n, consumed, nil
+}
+
+// decodeChunkSize is size of a chunk of decoded data, for each of which
+// cancellation is checked.
+const decodeChunkSize = 32 * 1024
+
+var copyBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, decodeChunkSize)
+		return &b
+	},
+}
+
+// copyContext copies size bytes from src to dst, like io.CopyN.  It checks
+// cancellation of ctx and calls progress for each chunk.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader, size int64, progress func(n int64)) (int64, error) {
+	bp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bp)
+	buf := *bp
+	var n int64
+	for n < size {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		m, err := io.ReadFull(src, buf[:min(size-n, int64(len(buf)))])
+		if m > 0 {
+			if _, werr := dst.Write(buf[:m]); werr != nil {
+				return n, werr
+			}
+			n += int64(m)
+			progress(n)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
 	}
-	r.curr = nil
 	return n, nil
 }
@@ -0,0 +1,190 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/internal/assert"
+	"github.com/koron-go/lha/lzhuff"
+)
+
+func TestReader_Reset(t *testing.T) {
+	a1 := testBuildArchive(t, testFile{"a.txt", "-lh5-", "Hello LHA\n"})
+	a2 := testBuildArchive(t,
+		testFile{"b.txt", "-lh6-", "Good-bye LHA\n"},
+		testFile{"c.txt", "-lh0-", "stored"},
+	)
+	r := NewReader(bytes.NewReader(a1))
+	// stop reading in the middle of the archive.
+	if _, err := r.NextHeader(); err != nil {
+		t.Fatal(err)
+	}
+	r.Reset(bytes.NewReader(a2))
+	var names []string
+	var out bytes.Buffer
+	for {
+		h, err := r.NextHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h == nil {
+			break
+		}
+		names = append(names, h.Name)
+		if _, err := r.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, []string{"b.txt", "c.txt"}, names)
+	assert.Equal(t, "Good-bye LHA\nstored", out.String())
+	assert.Equal(t, testReadFiles(t, a2)[1].HeaderOffset(), r.headerOffset)
+}
+
+func BenchmarkReader_SmallFiles(b *testing.B) {
+	var files []testFile
+	for range 100 {
+		files = append(files, testFile{"small.txt", "-lh5-", "Hello LHA. Good-bye LHA. Hello LHA.\n"})
+	}
+	a := testBuildArchive(b, files...)
+	b.ReportAllocs()
+	br := bytes.NewReader(a)
+	r := NewReader(br)
+	for b.Loop() {
+		br.Reset(a)
+		r.Reset(br)
+		for {
+			h, err := r.NextHeader()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if h == nil {
+				break
+			}
+			if _, err := r.Decode(io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// TestReader_Allocs checks reading headers and decoding files with a reset
+// reader makes only a few allocations for each entry: the header with its
+// copy, the name and the header CRC.
+func TestReader_Allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	const nfiles = 100
+	var files []testFile
+	for range nfiles {
+		files = append(files, testFile{"small.txt", "-lh5-", "Hello LHA. Good-bye LHA. Hello LHA.\n"})
+	}
+	a := testBuildArchive(t, files...)
+	br := bytes.NewReader(a)
+	r := NewReader(br)
+	allocs := testing.AllocsPerRun(10, func() {
+		br.Reset(a)
+		r.Reset(br)
+		for {
+			h, err := r.NextHeader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h == nil {
+				break
+			}
+			if _, err := r.Decode(io.Discard); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	// chunks shared by headers are allocated occasionally.
+	if allocs > 3*nfiles+4 {
+		t.Fatalf("too many allocations: %.0f for %d files", allocs, nfiles)
+	}
+}
+
+// lyingReader reports CRC of the data, but provides other data.
+type lyingReader struct {
+	io.Reader
+	crc uint16
+}
+
+func (r lyingReader) CRC16() uint16 { return r.crc }
+
+// TestReader_DecodeCRCUntrusted checks CRC reported by a registered
+// decompressor is not trusted.
+func TestReader_DecodeCRCUntrusted(t *testing.T) {
+	data := "Hello LHA\n"
+	crc := crc16.Checksum([]byte(data), crc16.IBMTable)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	fw, err := w.CreateRaw(&Header{
+		Method:       "-lh0-",
+		Name:         "a.txt",
+		PackedSize:   uint64(len(data)),
+		OriginalSize: uint64(len(data)),
+		CRC:          crc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, data)
+	w.Close()
+	r := NewReader(&b)
+	r.RegisterDecompressor("-lh0-", func(rd io.Reader, size int64) io.Reader {
+		return lyingReader{strings.NewReader(strings.ToUpper(data)), crc}
+	})
+	if _, err := r.NextHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Decode(io.Discard); err != errBodyCRCMismatch {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReader_DecodeCRC(t *testing.T) {
+	data := []byte(strings.Repeat("Hello LHA\n", 100))
+	for _, method := range []string{"-lh0-", "-lh5-", "-lh7-"} {
+		var packed bytes.Buffer
+		var zw io.WriteCloser = nopWriteCloser{&packed}
+		if method != "-lh0-" {
+			zw = lzhuff.NewWriter(&packed, method)
+		}
+		zw.Write(data)
+		zw.Close()
+		crc := crc16.Checksum(data, crc16.IBMTable)
+		for _, tc := range []struct {
+			crc  uint16
+			want error
+		}{
+			{crc, nil},
+			{crc ^ 1, errBodyCRCMismatch},
+		} {
+			var b bytes.Buffer
+			w := NewWriter(&b)
+			fw, err := w.CreateRaw(&Header{
+				Method:       method,
+				Name:         "a.txt",
+				PackedSize:   uint64(packed.Len()),
+				OriginalSize: uint64(len(data)),
+				CRC:          tc.crc,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(packed.Bytes())
+			w.Close()
+			r := NewReader(&b)
+			if _, err := r.NextHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Decode(io.Discard); err != tc.want {
+				t.Errorf("unexpected error for %s: want=%v got=%v", method, tc.want, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package lha
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Reproducible is options for Writer to create bit-identical archives from
+// same files, regardless of machines and times.
+type Reproducible struct {
+	// Epoch is upper bound of timestamps, usually SOURCE_DATE_EPOCH.  Later
+	// timestamps are clamped to it.  When Epoch is zero, all timestamps are
+	// zeroed: Header.Time is set to the UNIX epoch, and UNIX.Time and Windows
+	// times are removed.
+	Epoch time.Time
+	// OSID is written as OSID of all headers.
+	OSID uint8
+}
+
+// SourceDateEpoch returns time of SOURCE_DATE_EPOCH environment variable.
+// It returns zero time when the variable is not set.
+func SourceDateEpoch() (time.Time, error) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("lha: invalid SOURCE_DATE_EPOCH: %w", err)
+	}
+	return time.Unix(n, 0), nil
+}
+
+// SetReproducible makes w create reproducible archives with opts.  Entries
+// are sorted by paths, and written at Close.  Timestamps are clamped by
+// opts.Epoch, OSID is fixed, and UID, GID, user and group are zeroed.  The
+// built-in compressors are deterministic, so packed data depends only on
+// contents of files.  DOS timestamps of level 0 and 1 headers are written in
+// UTC, regardless of time.Local and SetLocation.  It must be called before
+// creating the first file.
+func (w *Writer) SetReproducible(opts Reproducible) {
+	w.reproducible = &opts
+	w.format.location = time.UTC
+}
+
+// normalize modifies h to be reproducible.
+func (rp *Reproducible) normalize(h *Header) {
+	if rp.Epoch.IsZero() {
+		h.Time = time.Unix(0, 0)
+		h.UNIX.Time = time.Time{}
+		h.Windows = HeaderWindows{}
+	} else {
+		if h.Time.IsZero() {
+			h.Time = rp.Epoch
+		}
+		h.Time = rp.clamp(h.Time)
+		h.UNIX.Time = rp.clamp(h.UNIX.Time)
+		h.Windows.CreationTime = rp.clamp(h.Windows.CreationTime)
+		h.Windows.ModificationTime = rp.clamp(h.Windows.ModificationTime)
+		h.Windows.AccessTime = rp.clamp(h.Windows.AccessTime)
+	}
+	h.OSID = rp.OSID
+	h.UNIX.UID = 0
+	h.UNIX.GID = 0
+	h.UNIX.User = ""
+	h.UNIX.Group = ""
+}
+
+// clamp clamps t by Epoch.
+func (rp *Reproducible) clamp(t time.Time) time.Time {
+	if t.After(rp.Epoch) {
+		return rp.Epoch
+	}
+	return t
+}
+
+// pendingEntry is a written entry which is held until Close, to be sorted.
+type pendingEntry struct {
+	path  string
+	spool *spool
+}
+
+// target returns a writer to which the entry of h is written.
+func (w *Writer) target(h *Header) io.Writer {
+	if w.reproducible == nil {
+		return w.w
+	}
+	w.reproducible.normalize(h)
+	sp := &spool{}
+	w.pending = append(w.pending, pendingEntry{path: h.slashPath(), spool: sp})
+	return sp
+}
+
+// flushPending writes all pending entries in order of paths.
+func (w *Writer) flushPending() error {
+	defer w.closePending()
+	pending := w.pending
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].path < pending[j].path
+	})
+	for _, p := range pending {
+		if _, err := p.spool.WriteTo(w.w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closePending discards all pending entries.
+func (w *Writer) closePending() {
+	for _, p := range w.pending {
+		p.spool.Close()
+	}
+	w.pending = nil
+}
@@ -0,0 +1,116 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testReproducible(t *testing.T, opts Reproducible, order []int, now time.Time, uid uint16, level uint8) []byte {
+	t.Helper()
+	files := []struct {
+		name, method, data string
+	}{
+		{"b.txt", "-lh5-", strings.Repeat("reproducible ", 1000)},
+		{"a/", "-lhd-", ""},
+		{"a/c.txt", "-lh7-", strings.Repeat("bit-identical ", 1000)},
+		{"a/d.txt", "-lh0-", "stored"},
+	}
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.SetHeaderLevel(level, false)
+	w.SetReproducible(opts)
+	for _, i := range order {
+		f := files[i]
+		dir, name := path.Split(f.name)
+		fw, err := w.CreateHeader(&Header{
+			Method: f.method,
+			Dir:    dir,
+			Name:   name,
+			Time:   now,
+			OSID:   'W',
+			UNIX:   HeaderUNIX{UID: uid, GID: uid, User: "user", Group: "group", Time: now},
+			Windows: HeaderWindows{
+				ModificationTime: now,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestWriter_Reproducible(t *testing.T) {
+	epoch := time.Unix(1700000000, 0)
+	opts := Reproducible{Epoch: epoch, OSID: 'U'}
+	b1 := testReproducible(t, opts, []int{0, 1, 2, 3}, time.Now(), 1000, 2)
+	prev := runtime.GOMAXPROCS(1)
+	b2 := testReproducible(t, opts, []int{3, 2, 1, 0}, time.Now().Add(time.Hour), 2000, 2)
+	runtime.GOMAXPROCS(prev)
+	if !bytes.Equal(b1, b2) {
+		t.Fatal("archives are not identical")
+	}
+
+	headers, _ := testReadAll(t, b1)
+	var paths []string
+	for _, h := range headers {
+		paths = append(paths, h.slashPath())
+		if !h.Time.Equal(epoch) || !h.UNIX.Time.Equal(epoch) || !h.Windows.ModificationTime.Equal(epoch) {
+			t.Errorf("time is not clamped: %s", h.slashPath())
+		}
+		assert.Equal(t, uint8('U'), h.OSID)
+		assert.Equal(t, HeaderUNIX{Time: h.UNIX.Time}, h.UNIX)
+	}
+	assert.Equal(t, []string{"a/", "a/c.txt", "a/d.txt", "b.txt"}, paths)
+
+	// older timestamps are kept.
+	old := time.Unix(1600000000, 0)
+	headers, _ = testReadAll(t, testReproducible(t, opts, []int{0}, old, 0, 2))
+	assert.Equal(t, old.Unix(), headers[0].Time.Unix())
+
+	// DOS timestamps of level 1 don't depend on the local time zone.
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.FixedZone("A", 9*60*60)
+	b1 = testReproducible(t, opts, []int{0, 1, 2, 3}, time.Now(), 1000, 1)
+	time.Local = time.FixedZone("B", -5*60*60)
+	b2 = testReproducible(t, opts, []int{3, 2, 1, 0}, time.Now(), 2000, 1)
+	if !bytes.Equal(b1, b2) {
+		t.Fatal("archives of level 1 are not identical")
+	}
+	headers, _ = testReadAll(t, b1)
+	assert.Equal(t, uint8(1), headers[0].Level)
+}
+
+func TestWriter_ReproducibleZeroEpoch(t *testing.T) {
+	b := testReproducible(t, Reproducible{}, []int{0, 2}, time.Now(), 1000, 2)
+	headers, _ := testReadAll(t, b)
+	for _, h := range headers {
+		assert.Equal(t, int64(0), h.Time.Unix())
+		assert.Equal(t, HeaderUNIX{}, h.UNIX)
+		assert.Equal(t, HeaderWindows{}, h.Windows)
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	tm, err := SourceDateEpoch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1700000000), tm.Unix())
+	t.Setenv("SOURCE_DATE_EPOCH", "xyz")
+	if _, err := SourceDateEpoch(); err == nil {
+		t.Fatal("invalid SOURCE_DATE_EPOCH should fail")
+	}
+}
@@ -0,0 +1,170 @@
+package lha
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RewriteOptions is options for Rewrite and RewriteFile.
+type RewriteOptions struct {
+	// Delete is patterns of path.Match for entries to be deleted.  They are
+	// matched with full slash separated paths, and an entry is deleted when
+	// its path or one of its parent directories matches.
+	Delete []string
+
+	// Source is a file system of files to be added.  Symbolic links are added
+	// when it implements ReadLink(name string) (string, error).
+	Source fs.FS
+	// Add is paths of files and directories in Source to be added
+	// recursively.  Entries of same paths in the archive are replaced in
+	// place, and other files are appended.
+	Add []string
+	// Newer replaces entries only when files in Source are newer than
+	// Header.Time of them, like "lha u".
+	Newer bool
+	// Method returns a method to compress a regular file of name.  Files are
+	// compressed with -lh5- when it is nil or returns "".
+	Method func(name string, fi fs.FileInfo) string
+
+	// Less reorders entries by their slash separated paths.  Entries keep
+	// their order when it is nil.
+	Less func(a, b string) bool
+}
+
+// rewriteEntry is an entry of the new archive.  It is copied from file when
+// file is not nil, or added from src in Source.
+type rewriteEntry struct {
+	path string
+	file *File
+	src  string
+	fi   fs.FileInfo
+}
+
+// Rewrite writes files of an existing archive to w, with deleting, replacing
+// and adding entries by opts.  Entries which are neither deleted nor replaced
+// are copied without decompression, in their original header levels.  w is
+// not closed.
+func Rewrite(w *Writer, files []*File, opts *RewriteOptions) error {
+	if opts == nil {
+		opts = &RewriteOptions{}
+	}
+	var entries []*rewriteEntry
+	index := map[string]*rewriteEntry{}
+	for _, f := range files {
+		p := f.slashPath()
+		if ok, err := matchPath(opts.Delete, p); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		e := &rewriteEntry{path: p, file: f}
+		entries = append(entries, e)
+		index[p] = e
+	}
+	for _, root := range opts.Add {
+		err := fs.WalkDir(opts.Source, root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name == "." {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			p := name
+			if d.IsDir() {
+				p += "/"
+			}
+			e, ok := index[p]
+			if !ok {
+				e = &rewriteEntry{path: p}
+				entries = append(entries, e)
+				index[p] = e
+			} else if opts.Newer && e.file != nil && compareModTime(&e.file.Header, fi.ModTime()) >= 0 {
+				return nil
+			}
+			e.file, e.src, e.fi = nil, name, fi
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Less != nil {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return opts.Less(entries[i].path, entries[j].path)
+		})
+	}
+	addOpts := &AddOptions{Method: opts.Method}
+	for _, e := range entries {
+		var err error
+		if e.file != nil {
+			err = w.Copy(e.file)
+		} else {
+			err = w.addFile(opts.Source, e.src, e.fi, addOpts)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.path, err)
+		}
+	}
+	return nil
+}
+
+// RewriteFile rewrites an archive file of name, like Rewrite.  The new archive
+// is written to a temporary file in the same directory, and it replaces the
+// original file by rename only when it is written completely.
+func RewriteFile(name string, opts *RewriteOptions) (err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	files, err := ReadFiles(f, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	bw := bufio.NewWriter(tmp)
+	w := NewWriter(bw)
+	if err := Rewrite(w, files, opts); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// the original file should be closed before rename on Windows.
+	f.Close()
+	return os.Rename(tmp.Name(), name)
+}
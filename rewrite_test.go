@@ -0,0 +1,127 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func TestRewriteFile(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, f := range []struct{ dir, name, data string }{
+		{"", "a.txt", "old a"},
+		{"", "b.txt", "old b"},
+		{"sub/", "c.txt", "old c"},
+		{"", "e.txt", "old e"},
+	} {
+		fw, err := w.CreateHeader(&Header{Method: "-lh5-", Dir: f.dir, Name: f.name, Time: mtime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "archive.lzh")
+	if err := os.WriteFile(name, b.Bytes(), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	src := fstest.MapFS{
+		"a.txt": {Data: []byte("new a"), Mode: 0644, ModTime: mtime.Add(time.Hour)},
+		"b.txt": {Data: []byte("new b"), Mode: 0644, ModTime: mtime.Add(-time.Hour)},
+		"d.txt": {Data: []byte("new d"), Mode: 0644, ModTime: mtime},
+	}
+	err := RewriteFile(name, &RewriteOptions{
+		Delete: []string{"sub"},
+		Source: src,
+		Add:    []string{"a.txt", "b.txt", "d.txt"},
+		Newer:  true,
+		Less:   func(a, b string) bool { return a > b },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, bodies := testReadAll(t, got)
+	contents := map[string]string{}
+	var paths []string
+	for i, h := range headers {
+		paths = append(paths, h.slashPath())
+		contents[h.slashPath()] = string(bodies[i])
+	}
+	assert.Equal(t, []string{"e.txt", "d.txt", "b.txt", "a.txt"}, paths)
+	assert.Equal(t, map[string]string{
+		"a.txt": "new a",
+		"b.txt": "old b",
+		"d.txt": "new d",
+		"e.txt": "old e",
+	}, contents)
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	// no temporary files are left.
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(name), ".archive.lzh.*"))
+	assert.Equal(t, 0, len(matches))
+}
+
+func TestRewriteFile_Failure(t *testing.T) {
+	orig := testBuildArchive(t, testFile{"a.txt", "-lh0-", "Hello"})
+	name := filepath.Join(t.TempDir(), "archive.lzh")
+	if err := os.WriteFile(name, orig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := RewriteFile(name, &RewriteOptions{Source: fstest.MapFS{}, Add: []string{"missing.txt"}})
+	if err == nil {
+		t.Fatal("adding missing file should fail")
+	}
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, got) {
+		t.Fatal("original archive is modified")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(name))
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestRewrite_Lv0(t *testing.T) {
+	lv0, err := os.ReadFile("testdata/header-lv0.lzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// strip the end marker.
+	lv0 = lv0[:len(lv0)-1]
+	e1 := testLv0Entry("-lh0-", "a.txt", []byte("deleted"))
+	e2 := testLv0Entry("-lh0-", `dir\b.txt`, []byte("kept"))
+	src := testArchive(e1, lv0, e2)
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if err := Rewrite(w, testReadFiles(t, src), &RewriteOptions{Delete: []string{"a.txt"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// kept entries are byte-identical, including their headers.
+	if want := testArchive(lv0, e2); !bytes.Equal(want, b.Bytes()) {
+		t.Fatalf("kept entries are modified:\nwant=% x\ngot= % x", want, b.Bytes())
+	}
+}
@@ -0,0 +1,141 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+)
+
+// scanChunkSize is size of a chunk which Scanner reads at once to find
+// signatures of methods.
+const scanChunkSize = 64 * 1024
+
+// Scanner finds LHA members embedded at arbitrary offsets in data, such as
+// BIOS images or disk images.  A member is recognised by its method
+// signature ("-lh?-" or "-lz?-"), checksum or CRC of the header, and sizes
+// which fit in the data.  Members don't need to be terminated with the
+// end-of-archive marker.
+type Scanner struct {
+	ra   io.ReaderAt
+	size int64
+	pos  int64
+	buf  []byte
+
+	file *File
+	err  error
+}
+
+// NewScanner creates a scanner for data in ra, which has size bytes.
+func NewScanner(ra io.ReaderAt, size int64) *Scanner {
+	return &Scanner{
+		ra:   ra,
+		size: size,
+		buf:  make([]byte, scanChunkSize),
+	}
+}
+
+// Scan advances the scanner to the next member.  It returns false when there
+// are no more members, or an I/O error occurs.
+func (s *Scanner) Scan() bool {
+	s.file = nil
+	for s.err == nil && s.pos < s.size {
+		n, err := s.ra.ReadAt(s.buf[:min(int64(len(s.buf)), s.size-s.pos)], s.pos)
+		if err != nil && err != io.EOF {
+			s.err = err
+			return false
+		}
+		d := s.buf[:n]
+		for i := 0; i+5 <= len(d); i++ {
+			j := bytes.IndexByte(d[i:len(d)-4], '-')
+			if j < 0 {
+				break
+			}
+			i += j
+			if !isMethodSignature(d[i : i+5]) {
+				continue
+			}
+			// the method is at offset 2 of headers of all levels.
+			off := s.pos + int64(i) - 2
+			if off < 0 {
+				continue
+			}
+			if f := s.tryMember(off); f != nil {
+				s.file = f
+				s.pos = f.bodyOffset + int64(f.bodySize())
+				return true
+			}
+		}
+		if n < 5 {
+			break
+		}
+		// next chunk overlaps last 4 bytes, which may have a signature.
+		s.pos += int64(n - 4)
+	}
+	return false
+}
+
+// File returns the member found by the last Scan.
+func (s *Scanner) File() *File {
+	return s.file
+}
+
+// Err returns the first I/O error which occurred in Scan.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// isMethodSignature reports whether d looks like "-lh?-" or "-lz?-".
+func isMethodSignature(d []byte) bool {
+	if d[0] != '-' || d[1] != 'l' || d[4] != '-' {
+		return false
+	}
+	if d[2] != 'h' && d[2] != 'z' {
+		return false
+	}
+	c := d[3]
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z')
+}
+
+// tryMember tries to read a member at off.  It returns nil when the data
+// doesn't look like a member.
+func (s *Scanner) tryMember(off int64) *File {
+	lr := NewReader(io.NewSectionReader(s.ra, off, s.size-off))
+	lv, err := lr.peekHeaderLevel()
+	if err != nil || lv > 2 {
+		return nil
+	}
+	h, err := lr.nextHeader()
+	if err != nil || h == nil {
+		return nil
+	}
+	if err := lr.verifyHeader(h); err != nil {
+		return nil
+	}
+	// a level 2 header without header CRC has no way to be verified.
+	if h.Level == 2 && h.HeaderCRC == nil {
+		return nil
+	}
+	switch h.Method {
+	case "-lh0-", "-lz4-":
+		if h.OriginalSize != h.bodySize() {
+			return nil
+		}
+	case "-lhd-":
+		if h.OriginalSize != 0 || h.bodySize() != 0 {
+			return nil
+		}
+	default:
+		if h.OriginalSize == 0 && h.bodySize() != 0 {
+			return nil
+		}
+	}
+	bodyOffset := off + lr.bodyOffset
+	if h.bodySize() > uint64(s.size-bodyOffset) {
+		return nil
+	}
+	return &File{
+		Header:       *h,
+		ra:           s.ra,
+		headerOffset: off + lr.headerOffset,
+		bodyOffset:   bodyOffset,
+	}
+}
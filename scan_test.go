@@ -0,0 +1,118 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+// testScanImage builds an image which has garbage and archives without
+// end-of-archive markers.
+func testScanImage(t *testing.T) ([]byte, []int64) {
+	t.Helper()
+	rnd := rand.New(rand.NewPCG(1, 2))
+	garbage := func(n int) []byte {
+		d := make([]byte, n)
+		for i := range d {
+			d[i] = byte(rnd.Uint32())
+		}
+		// fake signatures, which should be ignored.
+		copy(d[n/2:], "xx-lh5-yy")
+		return d
+	}
+	var (
+		img     []byte
+		offsets []int64
+	)
+	img = append(img, garbage(1000)...)
+	for i, f := range []testFile{
+		{"a.txt", "-lh5-", strings.Repeat("BIOS module A. ", 500)},
+		{"b.bin", "-lh0-", "stored module"},
+		{"c.txt", "-lh6-", strings.Repeat("BIOS module C. ", 5000)},
+	} {
+		arc := testBuildArchive(t, f)
+		offsets = append(offsets, int64(len(img)))
+		// drop the end-of-archive marker.
+		img = append(img, arc[:len(arc)-1]...)
+		img = append(img, garbage(scanChunkSize/2+i*777)...)
+	}
+	return img, offsets
+}
+
+func TestScanner(t *testing.T) {
+	img, offsets := testScanImage(t)
+	s := NewScanner(bytes.NewReader(img), int64(len(img)))
+	var (
+		gotOffsets []int64
+		names      []string
+	)
+	for s.Scan() {
+		f := s.File()
+		gotOffsets = append(gotOffsets, f.HeaderOffset())
+		names = append(names, f.Name)
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			t.Fatalf("decode %s failed: %s", f.Name, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, offsets, gotOffsets)
+	assert.Equal(t, []string{"a.txt", "b.bin", "c.txt"}, names)
+}
+
+func TestScanner_Levels(t *testing.T) {
+	var (
+		img   []byte
+		names []string
+	)
+	for _, name := range []string{"header-lv0.lzh", "header-lv1.lzh", "header-lv2.lzh"} {
+		raw, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers, _ := testReadAll(t, raw)
+		for _, h := range headers {
+			names = append(names, h.Name)
+		}
+		img = append(img, "garbage"...)
+		img = append(img, raw...)
+	}
+	s := NewScanner(bytes.NewReader(img), int64(len(img)))
+	var got []string
+	for s.Scan() {
+		got = append(got, s.File().Name)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, names, got)
+}
+
+func TestScanner_Garbage(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(3, 4))
+	d := make([]byte, 1<<20)
+	for i := range d {
+		d[i] = byte(rnd.Uint32())
+		if i%1000 == 0 {
+			copy(d[i:], "-lh5-")
+		}
+	}
+	s := NewScanner(bytes.NewReader(d), int64(len(d)))
+	for s.Scan() {
+		t.Errorf("unexpected member at %d", s.File().HeaderOffset())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,90 +6,180 @@ import (
 	"github.com/koron-go/lha/crc16"
 )
 
+// minChunk is minimum size of chunk to be flushed at once.
+const minChunk = 64 * 1024
+
 // Writer provides slide window (buffered) writer.
+//
+// Writer keeps the window and following data in a linear buffer.  The
+// window is placed at head of the buffer, data are appended after it, and
+// when the buffer gets full, data are flushed and last window is moved to
+// the head.  So copies from the window never wrap around.
 type Writer struct {
 	wr  io.Writer
-	cnt int
+	cnt int64
 	crc crc16.Hash16
 	buf []byte
+	win int
 	loc int
+	out int
 }
 
 // NewWriter create a slide window writer.
 func NewWriter(w io.Writer, bits uint) *Writer {
-	buf := make([]byte, 1<<bits)
-	for i := range buf {
-		buf[i] = ' '
-	}
-	return &Writer{
-		wr:  w,
-		buf: buf,
+	win := 1 << bits
+	sw := &Writer{
+		buf: make([]byte, win+max(win, minChunk)),
+		win: win,
 		crc: crc16.NewIBM(),
 	}
+	sw.Reset(w)
+	return sw
+}
+
+// Reset discards all data in the window, and resets the writer to write to
+// w.  It reuses the buffer.
+func (w *Writer) Reset(wr io.Writer) {
+	for i := range w.buf[:w.win] {
+		w.buf[i] = ' '
+	}
+	w.wr = wr
+	w.cnt = 0
+	w.crc.Reset()
+	w.loc = w.win
+	w.out = w.win
+}
+
+// Window returns a copy of last n bytes of the window.  n is limited by
+// size of the window.
+func (w *Writer) Window(n int) []byte {
+	n = min(n, w.win)
+	return append([]byte(nil), w.buf[w.loc-n:w.loc]...)
+}
+
+// Restore resets the writer to write to wr, like Reset.  And restores the
+// window with window, which is a snapshot by Window, and the written length
+// with n.
+func (w *Writer) Restore(wr io.Writer, window []byte, n int64) {
+	w.Reset(wr)
+	if len(window) > w.win {
+		window = window[len(window)-w.win:]
+	}
+	copy(w.buf[w.win-len(window):w.win], window)
+	w.cnt = n
 }
 
 // Flush flush all buffered data.
 func (w *Writer) Flush() error {
-	if w.loc == 0 {
+	if w.out == w.loc {
 		return nil
 	}
-	_, err := w.wr.Write(w.buf[:w.loc])
+	d := w.buf[w.out:w.loc]
+	_, err := w.wr.Write(d)
 	if err != nil {
 		return err
 	}
-	w.crc.Write(w.buf[:w.loc])
-	w.loc = 0
+	w.crc.Write(d)
+	w.out = w.loc
+	return nil
+}
+
+// slide flushes data and moves the last window to head of the buffer.
+func (w *Writer) slide() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	copy(w.buf, w.buf[w.loc-w.win:w.loc])
+	w.loc = w.win
+	w.out = w.win
 	return nil
 }
 
 // WriteByte writes a byte.
 func (w *Writer) WriteByte(b byte) error {
-	w.buf[w.loc] = b
-	w.loc++
 	if w.loc == len(w.buf) {
-		err := w.Flush()
-		if err != nil {
+		if err := w.slide(); err != nil {
 			return err
 		}
 	}
+	w.buf[w.loc] = b
+	w.loc++
 	w.cnt++
 	return nil
 }
 
+// Buffer returns the buffer and the position where next data are written.
+// Data before the position are written ones, and last WindowSize bytes of
+// them are the window.  Data can be written from the position directly, and
+// then Advance must be called with number of bytes written.  There is free
+// space after the position unless an error occurs.
+func (w *Writer) Buffer() (buf []byte, pos int, err error) {
+	if w.loc == len(w.buf) {
+		if err := w.slide(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return w.buf, w.loc, nil
+}
+
+// Advance marks n bytes after the position returned by Buffer as written.
+func (w *Writer) Advance(n int) {
+	w.loc += n
+	w.cnt += int64(n)
+}
+
+// WindowSize returns size of the window.
+func (w *Writer) WindowSize() int {
+	return w.win
+}
+
 // Write writes data.
 func (w *Writer) Write(p []byte) (int, error) {
-	for i, b := range p {
-		if err := w.WriteByte(b); err != nil {
-			return i, err
+	nw := 0
+	for len(p) > 0 {
+		if w.loc == len(w.buf) {
+			if err := w.slide(); err != nil {
+				return nw, err
+			}
 		}
+		n := copy(w.buf[w.loc:], p)
+		w.loc += n
+		w.cnt += int64(n)
+		nw += n
+		p = p[n:]
 	}
-	return len(p), nil
+	return nw, nil
 }
 
-// WriteCopy writes datat which copied from window buffer.
+// WriteCopy writes datat which copied from window buffer.  off is distance
+// from the end of the window minus one.
 func (w *Writer) WriteCopy(off, size int) (int, error) {
-	var (
-		st = (w.loc - off - 1 + len(w.buf)) % len(w.buf)
-		r  = len(w.buf) - st
-		nw = 0
-	)
+	dist := off + 1
+	if dist > w.win {
+		// refer the window cyclically, same as a ring buffer.
+		dist = (dist-1)%w.win + 1
+	}
+	nw := 0
 	for size > 0 {
-		if size <= r {
-			n, err := w.Write(w.buf[st : st+size])
-			nw += n
-			return nw, err
+		if w.loc == len(w.buf) {
+			if err := w.slide(); err != nil {
+				return nw, err
+			}
 		}
-		n, err := w.Write(w.buf[st : st+r])
-		nw += n
-		if err != nil {
-			return nw, err
+		n := min(size, len(w.buf)-w.loc)
+		st := w.loc - dist
+		if dist >= n {
+			copy(w.buf[w.loc:w.loc+n], w.buf[st:st+n])
+		} else {
+			// overlapped: expand the pattern by doubling.
+			for i := 0; i < n; {
+				i += copy(w.buf[w.loc+i:w.loc+n], w.buf[st:w.loc+i])
+			}
 		}
+		w.loc += n
+		w.cnt += int64(n)
+		nw += n
 		size -= n
-		st = 0
-		r = len(w.buf)
-		if size < r {
-			r = size
-		}
 	}
 	return nw, nil
 }
@@ -100,6 +190,6 @@ func (w *Writer) CRC16() uint16 {
 }
 
 // Len returns written length of bytes.
-func (w *Writer) Len() int {
+func (w *Writer) Len() int64 {
 	return w.cnt
 }
@@ -0,0 +1,132 @@
+package slide
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/koron-go/lha/crc16"
+)
+
+// refWriter is a simple ring buffer implementation of the slide window.
+type refWriter struct {
+	out []byte
+	buf []byte
+	loc int
+}
+
+func newRefWriter(bits uint) *refWriter {
+	return &refWriter{buf: bytes.Repeat([]byte{' '}, 1<<bits)}
+}
+
+func (r *refWriter) writeByte(b byte) {
+	r.buf[r.loc] = b
+	r.loc = (r.loc + 1) % len(r.buf)
+	r.out = append(r.out, b)
+}
+
+func (r *refWriter) writeCopy(off, size int) {
+	st := ((r.loc-off-1)%len(r.buf) + len(r.buf)) % len(r.buf)
+	for i := 0; i < size; i++ {
+		r.writeByte(r.buf[(st+i)%len(r.buf)])
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var (
+		bits = uint(13)
+		rnd  = rand.New(rand.NewPCG(1, 2))
+		ref  = newRefWriter(bits)
+		out  bytes.Buffer
+		w    = NewWriter(&out, bits)
+	)
+	for range 3 {
+		for range 100000 {
+			switch rnd.IntN(5) {
+			case 0:
+				b := byte(rnd.IntN(4) + 'a')
+				ref.writeByte(b)
+				if err := w.WriteByte(b); err != nil {
+					t.Fatal(err)
+				}
+			case 1:
+				p := []byte{byte(rnd.Uint32()), byte(rnd.Uint32())}
+				ref.writeByte(p[0])
+				ref.writeByte(p[1])
+				if _, err := w.Write(p); err != nil {
+					t.Fatal(err)
+				}
+			case 2:
+				// write directly to the buffer.
+				b := byte(rnd.IntN(4) + 'a')
+				ref.writeByte(b)
+				buf, pos, err := w.Buffer()
+				if err != nil {
+					t.Fatal(err)
+				}
+				buf[pos] = b
+				w.Advance(1)
+			default:
+				// overlapped copies are chosen frequently, and offsets
+				// over the window are also checked.
+				off := rnd.IntN(8)
+				if rnd.IntN(2) == 0 {
+					off = rnd.IntN(1 << (bits + 1))
+				}
+				size := rnd.IntN(254) + 3
+				ref.writeCopy(off, size)
+				if _, err := w.WriteCopy(off, size); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if w.Len() != int64(len(ref.out)) {
+			t.Fatalf("length mismatch: want=%d got=%d", len(ref.out), w.Len())
+		}
+		if !bytes.Equal(out.Bytes(), ref.out) {
+			t.Fatal("data mismatch")
+		}
+		if want := crc16.Update(0, crc16.IBMTable, ref.out); w.CRC16() != want {
+			t.Fatalf("CRC mismatch: want=%04x got=%04x", want, w.CRC16())
+		}
+		out.Reset()
+		ref = newRefWriter(bits)
+		w.Reset(&out)
+	}
+}
+
+func TestWriterRestore(t *testing.T) {
+	var (
+		bits = uint(8)
+		rnd  = rand.New(rand.NewPCG(3, 4))
+		full bytes.Buffer
+	)
+	w := NewWriter(&full, bits)
+	for range 1000 {
+		w.WriteByte(byte(rnd.IntN(256)))
+	}
+	win := w.Window(1 << 16)
+	if len(win) != 1<<bits {
+		t.Fatalf("unexpected window size: %d", len(win))
+	}
+	// continue from the snapshot with a new writer.
+	var part bytes.Buffer
+	w2 := NewWriter(&part, bits)
+	w2.Restore(&part, win, w.Len())
+	for _, sw := range []*Writer{w, w2} {
+		sw.WriteCopy(10, 300)
+		sw.WriteCopy(255, 20)
+		if err := sw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w2.Len() != w.Len() {
+		t.Fatalf("length mismatch: want=%d got=%d", w.Len(), w2.Len())
+	}
+	if !bytes.Equal(full.Bytes()[1000:], part.Bytes()) {
+		t.Fatal("data mismatch after restore")
+	}
+}
@@ -0,0 +1,69 @@
+package lha
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// spoolMemoryLimit is the maximum size of packed data which spool holds in
+// memory.
+const spoolMemoryLimit = 16 << 20
+
+// spool holds packed data of a file until its header is written.  Large data
+// is moved to a temporary file.
+type spool struct {
+	buf  bytes.Buffer
+	f    *os.File
+	size int64
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	if s.f == nil && s.buf.Len()+len(p) > spoolMemoryLimit {
+		f, err := os.CreateTemp("", "lha-spool-*")
+		if err != nil {
+			return 0, err
+		}
+		s.f = f
+		if _, err := s.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+	var (
+		n   int
+		err error
+	)
+	if s.f != nil {
+		n, err = s.f.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// WriteTo writes all held data to w.
+func (s *spool) WriteTo(w io.Writer) (int64, error) {
+	if s.f == nil {
+		return s.buf.WriteTo(w)
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, s.f)
+}
+
+// Close releases held data, and removes the temporary file.
+func (s *spool) Close() error {
+	s.buf.Reset()
+	if s.f == nil {
+		return nil
+	}
+	f := s.f
+	s.f = nil
+	err := f.Close()
+	if err2 := os.Remove(f.Name()); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package lha
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func TestSpool(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), spoolMemoryLimit/16+1)
+	var sp spool
+	sp.Write(data[:100])
+	if sp.f != nil {
+		t.Fatal("small data should be held in memory")
+	}
+	sp.Write(data[100:])
+	if sp.f == nil {
+		t.Fatal("large data should be moved to a file")
+	}
+	name := sp.f.Name()
+	assert.Equal(t, int64(len(data)), sp.size)
+	var b bytes.Buffer
+	if _, err := sp.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, b.Bytes()) {
+		t.Fatal("spooled data mismatch")
+	}
+	if err := sp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("temporary file should be removed: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package lha
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing/fstest"
+	"time"
+)
+
+// ExtractTarget is a destination of ExtractTo.  Names are slash separated
+// paths which are valid for fs.ValidPath.  A target may implement Lstat to
+// support ExtractOptions.Overwrite other than OverwriteAlways, and Remove to
+// discard files which failed to be extracted:
+//
+//	Lstat(name string) (fs.FileInfo, error)
+//	Remove(name string) error
+type ExtractTarget interface {
+	// Mkdir creates a directory name and its parents.
+	Mkdir(name string, h *Header) error
+	// Create creates a file name and its parents, to write contents of the
+	// entry of h.
+	Create(name string, h *Header) (io.WriteCloser, error)
+	// Symlink creates a symbolic link name to target.
+	Symlink(name, target string, h *Header) error
+	// SetMetadata sets metadata of the file or directory name from h, after
+	// it is created and written.
+	SetMetadata(name string, h *Header) error
+}
+
+type lstatTarget interface {
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+type removeTarget interface {
+	Remove(name string) error
+}
+
+// DirTarget is an ExtractTarget which extracts files into a directory of the
+// OS file system.  All files are accessed through os.Root, so it never writes
+// outside of the directory even when symbolic links point outside.
+type DirTarget struct {
+	dir  string
+	root *os.Root
+}
+
+// NewDirTarget creates a new DirTarget which extracts files into dir.  dir is
+// created when it doesn't exist.  It should be closed after use.
+func NewDirTarget(dir string) (*DirTarget, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DirTarget{dir: dir, root: root}, nil
+}
+
+// Close closes the directory.
+func (t *DirTarget) Close() error {
+	return t.root.Close()
+}
+
+func (t *DirTarget) mkdirAll(name string) error {
+	if name == "." {
+		return nil
+	}
+	if err := t.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	err := t.root.Mkdir(name, 0777)
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	return err
+}
+
+// Mkdir creates a directory with its parents.
+func (t *DirTarget) Mkdir(name string, h *Header) error {
+	return t.mkdirAll(name)
+}
+
+// Create creates a file with its parents.  Existing files are truncated.
+func (t *DirTarget) Create(name string, h *Header) (io.WriteCloser, error) {
+	if err := t.mkdirAll(path.Dir(name)); err != nil {
+		return nil, err
+	}
+	return t.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, h.Mode().Perm())
+}
+
+// Symlink creates a symbolic link with its parents.  Existing files are
+// replaced.
+func (t *DirTarget) Symlink(name, target string, h *Header) error {
+	dir := path.Dir(name)
+	if err := t.mkdirAll(dir); err != nil {
+		return err
+	}
+	if err := t.root.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// os.Root of go1.24 can't create symbolic links: check the parent is
+	// in the directory by opening it, then create the link by the path.
+	parent, err := t.root.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	parent.Close()
+	return os.Symlink(filepath.FromSlash(target), filepath.Join(t.dir, filepath.FromSlash(name)))
+}
+
+// SetMetadata sets modification time of a file or a directory.
+func (t *DirTarget) SetMetadata(name string, h *Header) error {
+	// os.Root of go1.24 can't change times: check the file and links to it
+	// are in the directory by Stat, then change them by the path.
+	if _, err := t.root.Stat(name); err != nil {
+		return err
+	}
+	return os.Chtimes(filepath.Join(t.dir, filepath.FromSlash(name)), h.Time, h.Time)
+}
+
+// Lstat returns fs.FileInfo of a file, without following symbolic links.
+func (t *DirTarget) Lstat(name string) (fs.FileInfo, error) {
+	return t.root.Lstat(name)
+}
+
+// Remove removes a file.
+func (t *DirTarget) Remove(name string) error {
+	return t.root.Remove(name)
+}
+
+// MapTarget is an ExtractTarget which extracts files into memory.  It can be
+// converted to fstest.MapFS to read the files.
+type MapTarget fstest.MapFS
+
+// mkdirAll adds name and its parents as directories, if they don't exist.
+func (m MapTarget) mkdirAll(name string) {
+	for ; name != "." && name != "/"; name = path.Dir(name) {
+		if _, ok := m[name]; ok {
+			return
+		}
+		m[name] = &fstest.MapFile{Mode: fs.ModeDir | 0777}
+	}
+}
+
+// Mkdir adds a directory with its parents.
+func (m MapTarget) Mkdir(name string, h *Header) error {
+	m.mkdirAll(name)
+	return nil
+}
+
+// Create returns a writer which adds a file with its parents on Close.
+func (m MapTarget) Create(name string, h *Header) (io.WriteCloser, error) {
+	return &mapFileWriter{m: m, name: name, mode: h.Mode().Perm()}, nil
+}
+
+// Symlink adds a symbolic link with its parents.  Data of the link is its
+// target.
+func (m MapTarget) Symlink(name, target string, h *Header) error {
+	m.mkdirAll(path.Dir(name))
+	m[name] = &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink | 0777, ModTime: h.Time}
+	return nil
+}
+
+// SetMetadata sets modification time of a file or a directory.
+func (m MapTarget) SetMetadata(name string, h *Header) error {
+	f, ok := m[name]
+	if !ok {
+		return &fs.PathError{Op: "setmetadata", Path: name, Err: fs.ErrNotExist}
+	}
+	f.ModTime = h.Time
+	return nil
+}
+
+// Lstat returns fs.FileInfo of a file.
+func (m MapTarget) Lstat(name string) (fs.FileInfo, error) {
+	f, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return &mapFileInfo{name: path.Base(name), f: f}, nil
+}
+
+// Remove removes a file.
+func (m MapTarget) Remove(name string) error {
+	delete(m, name)
+	return nil
+}
+
+// mapFileInfo is fs.FileInfo of fstest.MapFile, which doesn't follow symbolic
+// links.
+type mapFileInfo struct {
+	name string
+	f    *fstest.MapFile
+}
+
+func (fi *mapFileInfo) Name() string       { return fi.name }
+func (fi *mapFileInfo) Size() int64        { return int64(len(fi.f.Data)) }
+func (fi *mapFileInfo) Mode() fs.FileMode  { return fi.f.Mode }
+func (fi *mapFileInfo) ModTime() time.Time { return fi.f.ModTime }
+func (fi *mapFileInfo) IsDir() bool        { return fi.f.Mode.IsDir() }
+func (fi *mapFileInfo) Sys() any           { return fi.f.Sys }
+
+type mapFileWriter struct {
+	m    MapTarget
+	name string
+	mode fs.FileMode
+	buf  bytes.Buffer
+}
+
+func (w *mapFileWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+func (w *mapFileWriter) Close() error {
+	w.m.mkdirAll(path.Dir(w.name))
+	w.m[w.name] = &fstest.MapFile{Data: w.buf.Bytes(), Mode: w.mode}
+	return nil
+}
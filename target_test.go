@@ -0,0 +1,200 @@
+package lha
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testSymlinkArchive(t *testing.T, link string) []byte {
+	t.Helper()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, h := range []*Header{
+		{Method: "-lhd-", Dir: "sub/", Time: mtime, UNIX: HeaderUNIX{Perm: 040755}},
+		{Method: "-lh5-", Dir: "sub/", Name: "a.txt", Time: mtime, UNIX: HeaderUNIX{Perm: 0100640}},
+		{Method: "-lhd-", Dir: "sub/", Name: "link|" + link, Time: mtime, UNIX: HeaderUNIX{Perm: 0120777}},
+	} {
+		fw, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name == "a.txt" {
+			io.WriteString(fw, strings.Repeat("Hello LHA. ", 100))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExtractTo_MapTarget(t *testing.T) {
+	m := MapTarget{}
+	if err := ExtractTo(context.Background(), bytes.NewReader(testSymlinkArchive(t, "a.txt")), m, nil); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS(m)
+	b, err := fs.ReadFile(fsys, "sub/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.Repeat("Hello LHA. ", 100), string(b))
+	fi, err := fs.Stat(fsys, "sub/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fs.FileMode(0640), fi.Mode())
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Unix(), fi.ModTime().Unix())
+	assert.Equal(t, fs.ModeDir, m["sub"].Mode.Type())
+	assert.Equal(t, fs.ModeSymlink, m["sub/link"].Mode.Type())
+	assert.Equal(t, "a.txt", string(m["sub/link"].Data))
+	if err := fstest.TestFS(fsys, "sub/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrite policies work with MapTarget.
+	err = ExtractTo(context.Background(), bytes.NewReader(testSymlinkArchive(t, "a.txt")), m, &ExtractOptions{
+		Include:   []string{"sub/a.txt"},
+		Overwrite: OverwriteRename,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["sub/a.txt.1"]; !ok {
+		t.Fatal("renamed file is not extracted")
+	}
+}
+
+func TestExtractTo_UnsafeLink(t *testing.T) {
+	for _, link := range []string{"../../evil", "/etc/passwd"} {
+		m := MapTarget{}
+		err := ExtractTo(context.Background(), bytes.NewReader(testSymlinkArchive(t, link)), m, nil)
+		if err == nil || !strings.Contains(err.Error(), "unsafe link") {
+			t.Fatalf("unexpected error for %s: %v", link, err)
+		}
+		if _, ok := m["sub/link"]; ok {
+			t.Fatalf("unsafe link should not be extracted: %s", link)
+		}
+	}
+}
+
+func TestDirTarget_Symlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	dir := t.TempDir()
+	if err := Extract(context.Background(), bytes.NewReader(testSymlinkArchive(t, "a.txt")), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	link, err := os.Readlink(filepath.Join(dir, "sub", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "a.txt", link)
+	b, err := os.ReadFile(filepath.Join(dir, "sub", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.Repeat("Hello LHA. ", 100), string(b))
+}
+
+// testChainedLinkArchive has links which point inside of the target each, but
+// points outside of it when they are chained.
+func testChainedLinkArchive(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, h := range []*Header{
+		{Method: "-lhd-", Dir: "d1/"},
+		{Method: "-lhd-", Dir: "d1/", Name: "l|..", UNIX: HeaderUNIX{Perm: 0120777}},
+		{Method: "-lhd-", Dir: "d1/l/", Name: "l2|..", UNIX: HeaderUNIX{Perm: 0120777}},
+		{Method: "-lh0-", Dir: "d1/l/l2/", Name: "pwned.txt"},
+	} {
+		fw, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name == "pwned.txt" {
+			io.WriteString(fw, "pwned")
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExtractTo_ChainedLink(t *testing.T) {
+	m := MapTarget{}
+	err := ExtractTo(context.Background(), bytes.NewReader(testChainedLinkArchive(t)), m, nil)
+	if err == nil || !strings.Contains(err.Error(), "unsafe path") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := m["d1/l/l2"]; ok {
+		t.Fatal("link under a link should not be extracted")
+	}
+}
+
+func TestDirTarget_ChainedLink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	dir := t.TempDir()
+	err := Extract(context.Background(), bytes.NewReader(testChainedLinkArchive(t)), filepath.Join(dir, "out"), nil)
+	if err == nil || !strings.Contains(err.Error(), "unsafe path") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"l2", "pwned.txt", "d1/pwned.txt"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be created outside of the target: %v", name, err)
+		}
+	}
+}
+
+func TestDirTarget_Containment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	dir := t.TempDir()
+	target, err := NewDirTarget(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	h := &Header{Method: "-lh0-", Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	// the target rejects files through links by itself, without checks of
+	// ExtractTo.
+	if err := target.Symlink("l", "..", h); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := target.Create("l/pwned.txt", h); err == nil {
+		w.Close()
+		t.Fatal("file through a link should not be created")
+	}
+	if err := target.Mkdir("l/sub", h); err == nil {
+		t.Fatal("directory through a link should not be created")
+	}
+	if err := target.Symlink("l/l2", "..", h); err == nil {
+		t.Fatal("link through a link should not be created")
+	}
+	if err := target.SetMetadata("l", h); err == nil {
+		t.Fatal("metadata through a link should not be set")
+	}
+	for _, name := range []string{"pwned.txt", "sub", "l2"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be created outside of the target: %v", name, err)
+		}
+	}
+}
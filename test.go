@@ -0,0 +1,210 @@
+package lha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// Status is a result of testing an entry.
+type Status string
+
+const (
+	// StatusOK means the entry passed all checks.
+	StatusOK Status = "ok"
+	// StatusFailed means the entry failed some checks.
+	StatusFailed Status = "failed"
+	// StatusUnsupported means the entry is not decoded, because its method
+	// is not supported.
+	StatusUnsupported Status = "unsupported"
+)
+
+// EntryReport is a result of testing an entry in LHA archive.
+type EntryReport struct {
+	Header *Header `json:"-"`
+
+	// Name is full path of the entry.
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Status Status `json:"status"`
+
+	// PackedSize is actual size of packed data in the archive.
+	PackedSize uint64 `json:"packedSize"`
+	// OriginalSize is actual size of decoded data.
+	OriginalSize uint64 `json:"originalSize"`
+
+	// Err describes failed checks.  It is nil when Status is StatusOK.
+	Err error `json:"-"`
+}
+
+// MarshalJSON marshals EntryReport with Err as a string.
+func (e *EntryReport) MarshalJSON() ([]byte, error) {
+	type entryReport EntryReport
+	v := struct {
+		*entryReport
+		Error string `json:"error,omitempty"`
+	}{entryReport: (*entryReport)(e)}
+	if e.Err != nil {
+		v.Error = e.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// Report is a result of Test.
+type Report struct {
+	Entries []*EntryReport `json:"entries"`
+
+	// EndMarker is true when the archive is terminated with end-of-archive
+	// marker.
+	EndMarker bool `json:"endMarker"`
+	// Trailing is size of data after the end-of-archive marker.
+	Trailing int64 `json:"trailing"`
+
+	// Err is an error which stopped testing, such as a broken header.
+	Err error `json:"-"`
+}
+
+// MarshalJSON marshals Report with Err as a string.
+func (rp *Report) MarshalJSON() ([]byte, error) {
+	type report Report
+	v := struct {
+		*report
+		Error string `json:"error,omitempty"`
+	}{report: (*report)(rp)}
+	if rp.Err != nil {
+		v.Error = rp.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// OK returns true when all entries passed checks, and the archive is
+// terminated properly without trailing garbage.
+func (rp *Report) OK() bool {
+	if rp.Err != nil || !rp.EndMarker || rp.Trailing != 0 {
+		return false
+	}
+	for _, e := range rp.Entries {
+		if e.Status != StatusOK {
+			return false
+		}
+	}
+	return true
+}
+
+// errRecorder records an error of underlying io.Reader other than io.EOF.
+type errRecorder struct {
+	rd  io.Reader
+	err error
+}
+
+func (er *errRecorder) Read(b []byte) (int, error) {
+	n, err := er.rd.Read(b)
+	if err != nil && err != io.EOF && er.err == nil {
+		er.err = err
+	}
+	return n, err
+}
+
+// Test tests integrity of all entries in LHA archive.  It checks checksum or
+// CRC of headers, CRC of bodies, packed and original sizes, and trailing
+// garbage.  Testing continues even if some entries fail, as long as the next
+// header can be located.
+//
+// The returned error is an I/O error of r.  Problems of the archive are
+// reported in Report, which is returned even when error is not nil.
+func Test(r io.Reader) (*Report, error) {
+	return TestWithOptions(r, nil)
+}
+
+// TestWithOptions is Test which reads the archive with opts.
+func TestWithOptions(r io.Reader, opts *ReaderOptions) (*Report, error) {
+	er := &errRecorder{rd: r}
+	lr := NewReaderWithOptions(er, opts)
+	rp := &Report{}
+	for {
+		h, err := lr.nextHeader()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			rp.Err = err
+			return rp, er.err
+		}
+		if h == nil {
+			break
+		}
+		e := testEntry(lr, h)
+		rp.Entries = append(rp.Entries, e)
+		if lr.err != nil {
+			// reached EOF before end of packed data.
+			return rp, er.err
+		}
+	}
+
+	// check the end-of-archive marker and trailing data.
+	if d, err := lr.br.Peek(1); err == nil && d[0] == 0 {
+		rp.EndMarker = true
+		lr.br.Discard(1)
+	}
+	n, _ := io.Copy(io.Discard, lr.br)
+	rp.Trailing = n
+	return rp, er.err
+}
+
+func testEntry(r *Reader, h *Header) *EntryReport {
+	e := &EntryReport{
+		Header: h,
+		Name:   filepath.Join(h.Dir, h.Name),
+		Method: h.Method,
+		Status: StatusOK,
+	}
+	var errs []error
+	if err := r.verifyHeader(h); err != nil {
+		errs = append(errs, err)
+	}
+	for _, t := range slices.Sorted(maps.Keys(h.ValueErrors)) {
+		errs = append(errs, h.ValueErrors[t])
+	}
+
+	size := h.bodySize()
+	// used is size of packed data used by the decompressor.
+	used := size
+	if r.decompressor(h.Method) == nil {
+		e.Status = StatusUnsupported
+		errs = append(errs, fmt.Errorf("unsupported method: %s", h.Method))
+	} else {
+		n, consumed, err := r.decode(context.Background(), io.Discard)
+		e.OriginalSize = uint64(n)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			used = uint64(consumed)
+			if e.OriginalSize != h.OriginalSize {
+				errs = append(errs, fmt.Errorf("original size mismatch: declared=%d actual=%d", h.OriginalSize, e.OriginalSize))
+			}
+		}
+	}
+
+	// skip rest of packed data, and measure actual packed size.
+	if remain := r.remainToNext(); remain > 0 {
+		r.discard(remain)
+	}
+	r.curr = nil
+	e.PackedSize = h.PackedSize - (size - min(r.cnt, size, used))
+	if e.PackedSize != h.PackedSize {
+		errs = append(errs, fmt.Errorf("packed size mismatch: declared=%d actual=%d", h.PackedSize, e.PackedSize))
+	}
+
+	if len(errs) > 0 {
+		if e.Status == StatusOK {
+			e.Status = StatusFailed
+		}
+		e.Err = errors.Join(errs...)
+	}
+	return e
+}
@@ -0,0 +1,164 @@
+package lha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/internal/assert"
+	"github.com/koron-go/lha/lzhuff"
+)
+
+// testLv0Entry builds an entry with level 0 header, which stores data as is.
+func testLv0Entry(method, name string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(byte(22 + len(name)))
+	b.WriteByte(0) // checksum
+	b.WriteString(method)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	binary.Write(&b, binary.LittleEndian, uint32(0x3b4e4fdd))
+	b.WriteByte(0x20) // attribute
+	b.WriteByte(0)    // level
+	b.WriteByte(byte(len(name)))
+	b.WriteString(name)
+	binary.Write(&b, binary.LittleEndian, crc16.Checksum(data, crc16.IBMTable))
+	d := b.Bytes()
+	var sum uint8
+	for _, c := range d[2:] {
+		sum += c
+	}
+	d[1] = sum
+	return append(d, data...)
+}
+
+func testArchive(entries ...[]byte) []byte {
+	return append(bytes.Join(entries, nil), 0)
+}
+
+func testStatuses(rp *Report) []Status {
+	var s []Status
+	for _, e := range rp.Entries {
+		s = append(s, e.Status)
+	}
+	return s
+}
+
+func TestTest(t *testing.T) {
+	e1 := testLv0Entry("-lh0-", "foo.txt", []byte("Hello LHA\n"))
+	e2 := testLv0Entry("-lh0-", "bar.txt", []byte("Good-bye LHA\n"))
+
+	t.Run("ok", func(t *testing.T) {
+		rp, err := Test(bytes.NewReader(testArchive(e1, e2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusOK, StatusOK}, testStatuses(rp))
+		assert.Equal(t, "foo.txt", rp.Entries[0].Name)
+		assert.Equal(t, uint64(10), rp.Entries[0].OriginalSize)
+		assert.Equal(t, uint64(10), rp.Entries[0].PackedSize)
+		if !rp.OK() {
+			t.Fatalf("report should be OK: %+v", rp)
+		}
+	})
+
+	t.Run("body", func(t *testing.T) {
+		bad := bytes.Clone(e1)
+		bad[len(bad)-1] ^= 0xff
+		rp, err := Test(bytes.NewReader(testArchive(bad, e2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusFailed, StatusOK}, testStatuses(rp))
+		assert.Equal(t, errBodyCRCMismatch.Error(), rp.Entries[0].Err.Error())
+		if rp.OK() {
+			t.Fatal("report should not be OK")
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		bad := bytes.Clone(e2)
+		bad[16] ^= 0x01 // modify timestamp
+		rp, err := Test(bytes.NewReader(testArchive(e1, bad)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusOK, StatusFailed}, testStatuses(rp))
+		assert.Equal(t, errHeaderSumMismatch.Error(), rp.Entries[1].Err.Error())
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		e := testLv0Entry("-xyz-", "baz.txt", []byte("unknown"))
+		rp, err := Test(bytes.NewReader(testArchive(e, e2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusUnsupported, StatusOK}, testStatuses(rp))
+	})
+
+	t.Run("trailing", func(t *testing.T) {
+		rp, err := Test(bytes.NewReader(append(testArchive(e1, e2), "xyz"...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusOK, StatusOK}, testStatuses(rp))
+		assert.Equal(t, true, rp.EndMarker)
+		assert.Equal(t, int64(3), rp.Trailing)
+		if rp.OK() {
+			t.Fatal("report should not be OK")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		d := testArchive(e1, e2)
+		rp, err := Test(bytes.NewReader(d[:len(d)-5]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusOK, StatusFailed}, testStatuses(rp))
+		assert.Equal(t, uint64(9), rp.Entries[1].PackedSize)
+		assert.Equal(t, false, rp.EndMarker)
+		if !strings.Contains(rp.Entries[1].Err.Error(), "packed size mismatch") {
+			t.Fatalf("unexpected error: %s", rp.Entries[1].Err)
+		}
+	})
+
+	t.Run("unused", func(t *testing.T) {
+		// packed data which has extra bytes after the end of the stream.
+		data := []byte(strings.Repeat("Hello LHA\n", 100))
+		var packed bytes.Buffer
+		zw := lzhuff.NewWriter(&packed, "-lh5-")
+		zw.Write(data)
+		zw.Close()
+		var b bytes.Buffer
+		w := NewWriter(&b)
+		fw, err := w.CreateRaw(&Header{
+			Method:       "-lh5-",
+			Name:         "extra.txt",
+			PackedSize:   uint64(packed.Len() + 3),
+			OriginalSize: uint64(len(data)),
+			CRC:          crc16.Checksum(data, crc16.IBMTable),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(append(packed.Bytes(), "xyz"...))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		rp, err := Test(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []Status{StatusFailed}, testStatuses(rp))
+		assert.Equal(t, uint64(packed.Len()), rp.Entries[0].PackedSize)
+		if !strings.Contains(rp.Entries[0].Err.Error(), "packed size mismatch") {
+			t.Fatalf("unexpected error: %s", rp.Entries[0].Err)
+		}
+		if !rp.EndMarker || rp.Trailing != 0 {
+			t.Fatalf("the next header should be located: %+v", rp)
+		}
+	})
+}
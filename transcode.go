@@ -0,0 +1,229 @@
+package lha
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// slashPath returns full path of the file with slash separators.  Paths of
+// directories end with a slash.
+func (h *Header) slashPath() string {
+	name := h.Name
+	if link := h.Linkname(); link != "" {
+		name = strings.TrimSuffix(name, "|"+link)
+	}
+	p := path.Join(filepath.ToSlash(h.Dir), name)
+	if h.IsDir() {
+		p += "/"
+	}
+	return p
+}
+
+// ToTar converts all files in an LHA archive read from r, and writes them to
+// tw.  Names, times, modes, owners and directories are preserved.  tw is not
+// closed.
+func ToTar(tw *tar.Writer, r io.Reader) error {
+	return ToTarWithOptions(tw, r, nil)
+}
+
+// ToTarWithOptions is ToTar which reads the archive with opts.
+func ToTarWithOptions(tw *tar.Writer, r io.Reader, opts *ReaderOptions) error {
+	lr := NewReaderWithOptions(r, opts)
+	for {
+		h, err := lr.NextHeader()
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			return nil
+		}
+		th, err := tar.FileInfoHeader(h.FileInfo(), h.Linkname())
+		if err != nil {
+			return err
+		}
+		th.Name = h.slashPath()
+		th.Uid = int(h.UNIX.UID)
+		th.Gid = int(h.UNIX.GID)
+		th.Uname = h.UNIX.User
+		th.Gname = h.UNIX.Group
+		if err := tw.WriteHeader(th); err != nil {
+			return err
+		}
+		if th.Typeflag != tar.TypeReg {
+			continue
+		}
+		if _, err := lr.Decode(tw); err != nil {
+			return fmt.Errorf("%s: %w", th.Name, err)
+		}
+	}
+}
+
+// ToZip converts all files in an LHA archive read from r, and writes them to
+// zw.  Names, times, modes, comments and directories are preserved.  Files
+// are compressed with zip.Deflate.  zw is not closed.
+func ToZip(zw *zip.Writer, r io.Reader) error {
+	return ToZipWithOptions(zw, r, nil)
+}
+
+// ToZipWithOptions is ToZip which reads the archive with opts.
+func ToZipWithOptions(zw *zip.Writer, r io.Reader, opts *ReaderOptions) error {
+	lr := NewReaderWithOptions(r, opts)
+	for {
+		h, err := lr.NextHeader()
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			return nil
+		}
+		zh, err := zip.FileInfoHeader(h.FileInfo())
+		if err != nil {
+			return err
+		}
+		zh.Name = h.slashPath()
+		zh.Comment = h.Comment
+		if !h.IsDir() {
+			zh.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(zh)
+		if err != nil {
+			return err
+		}
+		switch {
+		case h.IsDir():
+		case h.Linkname() != "":
+			// zip stores the target of a symbolic link as its contents.
+			if _, err := io.WriteString(fw, h.Linkname()); err != nil {
+				return err
+			}
+		default:
+			if _, err := lr.Decode(fw); err != nil {
+				return fmt.Errorf("%s: %w", zh.Name, err)
+			}
+		}
+	}
+}
+
+// headerFromInfo creates a header for the file with name and fi.  name is
+// slash separated path.  The file is compressed with method, when it is a
+// regular file.
+func headerFromInfo(name string, fi fs.FileInfo, link, method string) *Header {
+	dir, base := path.Split(strings.TrimSuffix(name, "/"))
+	h := &Header{
+		Method:    method,
+		Time:      fi.ModTime(),
+		Attribute: 0x20,
+		OSID:      'U',
+		Name:      base,
+		Dir:       filepath.FromSlash(dir),
+		UNIX: HeaderUNIX{
+			Perm: unixPerm(fi.Mode()),
+		},
+	}
+	switch {
+	case fi.IsDir():
+		h.Method = "-lhd-"
+		h.Attribute = 0x10
+		h.Name = ""
+		h.Dir = filepath.FromSlash(dir + base + "/")
+	case fi.Mode()&fs.ModeSymlink != 0:
+		h.Method = "-lhd-"
+		h.Name = base + "|" + link
+	}
+	if fi.Mode().Perm()&0222 == 0 {
+		// read only
+		h.Attribute |= 0x01
+	}
+	return h
+}
+
+// FromTar converts all files read from tr, and adds them to w.  Regular
+// files are compressed with method.  Directories and symbolic links are
+// added as -lhd-, and other types of files are rejected.  w is not closed.
+func FromTar(w *Writer, tr *tar.Reader, method string) error {
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch th.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+		default:
+			return fmt.Errorf("lha: unsupported tar entry type %q: %s", th.Typeflag, th.Name)
+		}
+		h := headerFromInfo(th.Name, th.FileInfo(), th.Linkname, method)
+		if th.Uid <= math.MaxUint16 && th.Gid <= math.MaxUint16 {
+			h.UNIX.UID = uint16(th.Uid)
+			h.UNIX.GID = uint16(th.Gid)
+		}
+		h.UNIX.User = th.Uname
+		h.UNIX.Group = th.Gname
+		fw, err := w.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if th.Typeflag != tar.TypeReg {
+			continue
+		}
+		if _, err := io.Copy(fw, tr); err != nil {
+			return fmt.Errorf("%s: %w", th.Name, err)
+		}
+	}
+}
+
+// FromZip converts all files in zr, and adds them to w.  Regular files are
+// compressed with method.  Directories and symbolic links are added as
+// -lhd-.  w is not closed.
+func FromZip(w *Writer, zr *zip.Reader, method string) error {
+	for _, f := range zr.File {
+		if err := fromZipFile(w, f, method); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func fromZipFile(w *Writer, f *zip.File, method string) error {
+	fi := f.FileInfo()
+	if !fi.IsDir() && !fi.Mode().IsRegular() && fi.Mode()&fs.ModeSymlink == 0 {
+		return fmt.Errorf("lha: unsupported file mode: %s", fi.Mode())
+	}
+	var rc io.ReadCloser
+	if !fi.IsDir() {
+		var err error
+		rc, err = f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+	}
+	var link string
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		link = string(b)
+	}
+	h := headerFromInfo(f.Name, fi, link, method)
+	h.Comment = f.Comment
+	fw, err := w.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	_, err = io.Copy(fw, rc)
+	return err
+}
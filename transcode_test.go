@@ -0,0 +1,172 @@
+package lha
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koron-go/lha/internal/assert"
+)
+
+type testMember struct {
+	Path  string
+	Mode  fs.FileMode
+	Link  string
+	Data  string
+	User  string
+	Group string
+}
+
+var testTranscodeTime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+// testTranscodeArchive builds an archive which has a directory, files and a
+// symbolic link with UNIX metadata.
+func testTranscodeArchive(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, h := range []*Header{
+		{Method: "-lhd-", Dir: "sub/", UNIX: HeaderUNIX{Perm: 0040755}},
+		{Method: "-lh5-", Dir: "sub/", Name: "a.txt", Comment: "file a", UNIX: HeaderUNIX{Perm: 0100600, UID: 1000, GID: 100, User: "koron", Group: "users"}},
+		{Method: "-lhd-", Dir: "sub/", Name: "link|a.txt", UNIX: HeaderUNIX{Perm: 0120777}},
+		{Method: "-lh0-", Name: "b.txt", UNIX: HeaderUNIX{Perm: 0100644}},
+	} {
+		h.Time = testTranscodeTime
+		h.OSID = 'U'
+		fw, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Method != "-lhd-" {
+			io.WriteString(fw, strings.Repeat(h.Name+"\n", 100))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+var testTranscodeEntries = []testMember{
+	{"sub/", fs.ModeDir | 0755, "", "", "", ""},
+	{"sub/a.txt", 0600, "", strings.Repeat("a.txt\n", 100), "koron", "users"},
+	{"sub/link", fs.ModeSymlink | 0777, "a.txt", "", "", ""},
+	{"b.txt", 0644, "", strings.Repeat("b.txt\n", 100), "", ""},
+}
+
+// testCheckLHA checks headers and bodies of transcoded LHA archive.
+func testCheckLHA(t *testing.T, b []byte) []*Header {
+	t.Helper()
+	headers, bodies := testReadAll(t, b)
+	var got []testMember
+	for i, h := range headers {
+		got = append(got, testMember{h.slashPath(), h.Mode(), h.Linkname(), string(bodies[i]), h.UNIX.User, h.UNIX.Group})
+		if !h.Time.Equal(testTranscodeTime) {
+			t.Errorf("time mismatch for %s: %s", h.slashPath(), h.Time)
+		}
+	}
+	assert.Equal(t, testTranscodeEntries, got)
+	return headers
+}
+
+func TestTar_RoundTrip(t *testing.T) {
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	if err := ToTar(tw, bytes.NewReader(testTranscodeArchive(t))); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []testMember
+	tr := tar.NewReader(bytes.NewReader(tb.Bytes()))
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		got = append(got, testMember{th.Name, th.FileInfo().Mode(), th.Linkname, string(data), th.Uname, th.Gname})
+		if th.Name == "sub/a.txt" {
+			assert.Equal(t, 1000, th.Uid)
+			assert.Equal(t, 100, th.Gid)
+		}
+	}
+	assert.Equal(t, testTranscodeEntries, got)
+
+	var lb bytes.Buffer
+	w := NewWriter(&lb)
+	if err := FromTar(w, tar.NewReader(bytes.NewReader(tb.Bytes())), "-lh5-"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	headers := testCheckLHA(t, lb.Bytes())
+	assert.Equal(t, "-lh5-", headers[1].Method)
+	assert.Equal(t, uint16(1000), headers[1].UNIX.UID)
+	assert.Equal(t, uint16(100), headers[1].UNIX.GID)
+}
+
+func TestZip_RoundTrip(t *testing.T) {
+	var zb bytes.Buffer
+	zw := zip.NewWriter(&zb)
+	if err := ToZip(zw, bytes.NewReader(testTranscodeArchive(t))); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(zb.Bytes()), int64(zb.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, len(zr.File))
+	assert.Equal(t, "sub/a.txt", zr.File[1].Name)
+	assert.Equal(t, "file a", zr.File[1].Comment)
+	assert.Equal(t, zip.Deflate, zr.File[1].Method)
+
+	var lb bytes.Buffer
+	w := NewWriter(&lb)
+	if err := FromZip(w, zr, "-lh6-"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	headers, bodies := testReadAll(t, lb.Bytes())
+	var got []testMember
+	for i, h := range headers {
+		// zip has no owners.
+		got = append(got, testMember{h.slashPath(), h.Mode(), h.Linkname(), string(bodies[i]), "", ""})
+		if !h.Time.Equal(testTranscodeTime) {
+			t.Errorf("time mismatch for %s: %s", h.slashPath(), h.Time)
+		}
+	}
+	want := append([]testMember(nil), testTranscodeEntries...)
+	want[1].User, want[1].Group = "", ""
+	assert.Equal(t, want, got)
+	assert.Equal(t, "file a", headers[1].Comment)
+	assert.Equal(t, "-lh6-", headers[1].Method)
+}
+
+func TestFromTar_Unsupported(t *testing.T) {
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeFifo, Name: "fifo", Mode: 0644})
+	tw.Close()
+	w := NewWriter(io.Discard)
+	if err := FromTar(w, tar.NewReader(&tb), "-lh5-"); err == nil {
+		t.Fatal("FromTar should reject fifo")
+	}
+}
@@ -0,0 +1,855 @@
+package lha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koron-go/lha/crc16"
+)
+
+var (
+	errWriterClosed     = errors.New("lha: writer is closed")
+	errTooLargeHeader   = errors.New("lha: too large header")
+	errUnsupportedLevel = errors.New("lha: unsupported header level to write")
+	errRawSizeMismatch  = errors.New("lha: size of raw data mismatch")
+	errTooLargeExtData  = errors.New("lha: too large extended header")
+	errTooLongName      = errors.New("lha: too long name for the header level")
+	errTooLargeSize     = errors.New("lha: too large size for the header level")
+	errDropExtra        = errors.New("lha: extended header can't be written in level 0")
+	errTimeOutOfRange   = errors.New("lha: time out of range of 32-bit UNIX time")
+)
+
+// Writer is LHA archive writer.
+type Writer struct {
+	w      io.Writer
+	err    error
+	curr   fileWriter
+	dst    io.Writer
+	closed bool
+	// closeDone and closeErr are the state and the result of Close, which
+	// are returned by later calls.
+	closeDone bool
+	closeErr  error
+
+	// level is the default level of headers.
+	level  uint8
+	format headerFormat
+
+	compressors  map[string]Compressor
+	reproducible *Reproducible
+	pending      []pendingEntry
+	appender     *appender
+}
+
+// fileWriter is a writer of a file being written.
+type fileWriter interface {
+	io.Writer
+	// finish writes the file to w.
+	finish(w io.Writer) error
+}
+
+// entryWriter compresses a file and holds packed data, until the header is
+// written.
+type entryWriter struct {
+	h      *Header
+	format headerFormat
+	cw     io.WriteCloser
+	crc    crc16.Hash16
+	size   uint64
+	spool  *spool
+}
+
+func (e *entryWriter) Write(p []byte) (int, error) {
+	if e.h.IsDir() && len(p) > 0 {
+		return 0, errDirHasData
+	}
+	n, err := e.cw.Write(p)
+	e.crc.Write(p[:n])
+	e.size += uint64(n)
+	return n, err
+}
+
+// NewWriter creates LHA archive writer.  Headers are written in level 2 by
+// default.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, level: 2}
+}
+
+// SetHeaderLevel sets the level of headers (0 to 3) to write, which is used
+// for headers with Level 0.  It can be changed between files.  A header is
+// upgraded to level 2 or 3 when it can't be represented in the level, because
+// of a long name or 64-bit sizes.  When strict is true, creating such files
+// fails instead, and so does level 0 header which would drop extended
+// headers.
+func (w *Writer) SetHeaderLevel(level uint8, strict bool) {
+	w.level = level
+	w.format.strict = strict
+}
+
+// SetLocation sets a location of DOS timestamps in headers of level 0 and 1.
+// time.Local is used by default.  It is ignored for reproducible archives,
+// which use UTC.
+func (w *Writer) SetLocation(loc *time.Location) {
+	if w.reproducible != nil {
+		return
+	}
+	w.format.location = loc
+}
+
+// headerLevel determines the level of h to write.  h.Level is kept as is when
+// keep is true.
+func (w *Writer) headerLevel(h *Header, keep bool) error {
+	if h.Level == 0 && !keep {
+		h.Level = w.level
+	}
+	if _, ok := headerMarshalers[h.Level]; !ok {
+		return errUnsupportedLevel
+	}
+	return nil
+}
+
+// RegisterCompressor registers or overrides a compressor for a method, only
+// for this writer.
+func (w *Writer) RegisterCompressor(method string, comp Compressor) {
+	if w.compressors == nil {
+		w.compressors = map[string]Compressor{}
+	}
+	w.compressors[method] = comp
+}
+
+func (w *Writer) compressor(method string) Compressor {
+	if comp, ok := w.compressors[method]; ok {
+		return comp
+	}
+	return compressor(method)
+}
+
+// Create adds a file to the archive with name, and returns a writer to which
+// the file contents should be written.  The name is a slash separated path.
+// The file is stored without compression (-lh0-).
+func (w *Writer) Create(name string) (io.Writer, error) {
+	dir, base := path.Split(name)
+	return w.CreateHeader(&Header{
+		Method: "-lh0-",
+		Time:   time.Now(),
+		Name:   base,
+		Dir:    filepath.FromSlash(dir),
+	})
+}
+
+// CreateHeader adds a file to the archive using h, and returns a writer to
+// which the file contents should be written.  The contents must be written
+// before the next call to CreateHeader or Close.
+//
+// The Writer takes ownership of h: PackedSize, OriginalSize, CRC and fields
+// of the header itself are updated when the file is written.  Extended
+// headers in h.Extra are written in order: known types are regenerated from
+// typed fields of h, and unknown types are written as is.  The header is
+// written in h.Level, or the level of the writer when it is 0.
+func (w *Writer) CreateHeader(h *Header) (io.Writer, error) {
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	if h.Method == "" {
+		h.Method = "-lh0-"
+	}
+	comp := w.compressor(h.Method)
+	if comp == nil {
+		return nil, fmt.Errorf("lha: unsupported method to write: %s", h.Method)
+	}
+	if err := w.headerLevel(h, false); err != nil {
+		return nil, err
+	}
+	sp := &spool{}
+	cw, err := comp(sp)
+	if err != nil {
+		return nil, err
+	}
+	w.dst = w.target(h)
+	w.curr = &entryWriter{
+		h:      h,
+		format: w.format,
+		cw:     cw,
+		crc:    crc16.NewIBM(),
+		spool:  sp,
+	}
+	return w.curr, nil
+}
+
+// finish writes the current file to underlying writer.
+func (w *Writer) finish() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	e := w.curr
+	if e == nil {
+		return nil
+	}
+	w.curr = nil
+	w.err = e.finish(w.dst)
+	return w.err
+}
+
+func (e *entryWriter) finish(w io.Writer) error {
+	defer e.spool.Close()
+	if err := e.cw.Close(); err != nil {
+		return err
+	}
+	h := e.h
+	h.OriginalSize = e.size
+	h.PackedSize = uint64(e.spool.size)
+	h.CRC = e.crc.Sum16()
+	b, err := marshalHeader(h, e.format)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err = e.spool.WriteTo(w)
+	return err
+}
+
+// rawWriter writes packed data of a file as is, after its header.
+type rawWriter struct {
+	w    io.Writer
+	h    *Header
+	size uint64
+}
+
+func (e *rawWriter) Write(p []byte) (int, error) {
+	if e.size+uint64(len(p)) > e.h.bodySize() {
+		return 0, errRawSizeMismatch
+	}
+	n, err := e.w.Write(p)
+	e.size += uint64(n)
+	return n, err
+}
+
+func (e *rawWriter) finish(io.Writer) error {
+	if e.size != e.h.bodySize() {
+		return errRawSizeMismatch
+	}
+	return nil
+}
+
+// CreateRaw adds a file to the archive using h, and returns a writer to which
+// the packed data should be written as is.  PackedSize, OriginalSize and CRC
+// of h must be set, and the written data must be size of packed data, which
+// is PackedSize without extended headers for level 1.  The header is written
+// in h.Level, or the level of the writer when it is 0.
+func (w *Writer) CreateRaw(h *Header) (io.Writer, error) {
+	return w.createRaw(h, false)
+}
+
+func (w *Writer) createRaw(h *Header, keepLevel bool) (io.Writer, error) {
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	h.PackedSize = h.bodySize()
+	if err := w.headerLevel(h, keepLevel); err != nil {
+		return nil, err
+	}
+	dst := w.target(h)
+	b, err := marshalHeader(h, w.format)
+	if err != nil {
+		w.err = err
+		return nil, err
+	}
+	if _, err := dst.Write(b); err != nil {
+		w.err = err
+		return nil, err
+	}
+	w.curr = &rawWriter{w: dst, h: h}
+	return w.curr, nil
+}
+
+// Copy copies a file f into the archive, without decompressing and
+// compressing data.  The header is written in the level of f.
+func (w *Writer) Copy(f *File) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	h := f.Header
+	h.Extra = append([]ExtendedHeader(nil), f.Extra...)
+	fw, err := w.createRaw(&h, true)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+// Close finishes writing the archive, by writing the current file and the
+// end marker.  It doesn't close the underlying writer.  Later calls do
+// nothing, and return the result of the first call.
+func (w *Writer) Close() error {
+	if w.closeDone {
+		return w.closeErr
+	}
+	w.closeDone = true
+	err := w.close()
+	if w.appender != nil {
+		if err == nil {
+			err = w.appender.commit()
+		}
+		if err != nil {
+			w.appender.rollback()
+		}
+	}
+	w.closeErr = err
+	return err
+}
+
+func (w *Writer) close() error {
+	if err := w.finish(); err != nil {
+		w.closePending()
+		return err
+	}
+	if err := w.flushPending(); err != nil {
+		return err
+	}
+	w.closed = true
+	_, err := w.w.Write([]byte{0})
+	return err
+}
+
+type exHeaderWriter struct {
+	// needed reports whether the extended header is required for h.
+	needed func(h *Header) bool
+	// data generates payload of the extended header from h.
+	data func(h *Header) []byte
+}
+
+var exHeaderWriters = map[uint8]exHeaderWriter{
+	0x00: {
+		needed: func(*Header) bool { return true },
+		// CRC is calculated after whole header generated.
+		data: func(*Header) []byte { return []byte{0, 0} },
+	},
+	0x01: {
+		needed: func(*Header) bool { return true },
+		data:   func(h *Header) []byte { return []byte(h.Name) },
+	},
+	0x02: {
+		needed: func(h *Header) bool { return h.Dir != "" },
+		data:   writeDirectory,
+	},
+	0x3f: {
+		needed: func(h *Header) bool { return h.Comment != "" },
+		data:   func(h *Header) []byte { return []byte(h.Comment) },
+	},
+	0x40: {
+		needed: func(h *Header) bool { return h.DOS.Attr != 0 },
+		data: func(h *Header) []byte {
+			return binary.LittleEndian.AppendUint16(nil, h.DOS.Attr)
+		},
+	},
+	0x41: {
+		needed: func(h *Header) bool {
+			return !h.Windows.CreationTime.IsZero() ||
+				!h.Windows.ModificationTime.IsZero() ||
+				!h.Windows.AccessTime.IsZero()
+		},
+		data: func(h *Header) []byte {
+			b := binary.LittleEndian.AppendUint64(nil, toFileTime(h.Windows.CreationTime))
+			b = binary.LittleEndian.AppendUint64(b, toFileTime(h.Windows.ModificationTime))
+			return binary.LittleEndian.AppendUint64(b, toFileTime(h.Windows.AccessTime))
+		},
+	},
+	0x42: {
+		needed: func(h *Header) bool {
+			return h.PackedSize > math.MaxUint32 || h.OriginalSize > math.MaxUint32
+		},
+		data: func(h *Header) []byte {
+			b := binary.LittleEndian.AppendUint64(nil, h.PackedSize)
+			return binary.LittleEndian.AppendUint64(b, h.OriginalSize)
+		},
+	},
+	0x50: {
+		needed: func(h *Header) bool { return h.UNIX.Perm != 0 },
+		data: func(h *Header) []byte {
+			return binary.LittleEndian.AppendUint16(nil, h.UNIX.Perm)
+		},
+	},
+	0x51: {
+		needed: func(h *Header) bool { return h.UNIX.GID != 0 || h.UNIX.UID != 0 },
+		data: func(h *Header) []byte {
+			b := binary.LittleEndian.AppendUint16(nil, h.UNIX.GID)
+			return binary.LittleEndian.AppendUint16(b, h.UNIX.UID)
+		},
+	},
+	0x52: {
+		needed: func(h *Header) bool { return h.UNIX.Group != "" },
+		data:   func(h *Header) []byte { return []byte(h.UNIX.Group) },
+	},
+	0x53: {
+		needed: func(h *Header) bool { return h.UNIX.User != "" },
+		data:   func(h *Header) []byte { return []byte(h.UNIX.User) },
+	},
+	0x54: {
+		needed: func(h *Header) bool { return !h.UNIX.Time.IsZero() },
+		data: func(h *Header) []byte {
+			// the range is checked by extendedHeaders.
+			ut, _ := unixTime32(h.UNIX.Time)
+			return binary.LittleEndian.AppendUint32(nil, ut)
+		},
+	},
+}
+
+// writeDirectory generates payload of directory extended header, which uses
+// 0xff as path separator.
+func writeDirectory(h *Header) []byte {
+	dir := strings.Trim(filepath.ToSlash(h.Dir), "/")
+	if dir == "" {
+		return nil
+	}
+	b := []byte(dir + "/")
+	for i, c := range b {
+		if c == '/' {
+			b[i] = 0xff
+		}
+	}
+	return b
+}
+
+// extendedHeaders determines extended headers to be written for h.  Known
+// types in h.Extra keep their raw payload when it still represents fields of
+// h, otherwise they are regenerated or dropped.  Types registered by
+// RegisterExtendedHeader are handled in same way with h.Values.  Unknown
+// types are kept as is.  Types which are needed but absent in h.Extra are
+// appended in ascending order of types.
+func extendedHeaders(h *Header) ([]ExtendedHeader, error) {
+	if _, err := unixTime32(h.UNIX.Time); err != nil {
+		return nil, err
+	}
+	var (
+		list []ExtendedHeader
+		seen = map[uint8]bool{}
+	)
+	for _, x := range h.Extra {
+		if seen[x.Type] {
+			continue
+		}
+		if handler, ok := customExHeader(x.Type); ok {
+			seen[x.Type] = true
+			d, ok, err := writeCustomExHeader(h, handler, x.Type, x.Data)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				list = append(list, ExtendedHeader{Type: x.Type, Data: d})
+			}
+			continue
+		}
+		ew, ok := exHeaderWriters[x.Type]
+		if !ok {
+			list = append(list, x)
+			continue
+		}
+		seen[x.Type] = true
+		data := ew.data(h)
+		if x.Type != 0x00 {
+			var scratch Header
+			err := exHeaderReaders[x.Type](&scratch, x.Data)
+			if err == nil && bytes.Equal(ew.data(&scratch), data) {
+				list = append(list, x)
+				continue
+			}
+		}
+		if ew.needed(h) {
+			list = append(list, ExtendedHeader{Type: x.Type, Data: data})
+		}
+	}
+	types := make([]int, 0, len(exHeaderWriters)+len(h.Values))
+	for t := range exHeaderWriters {
+		types = append(types, int(t))
+	}
+	for t := range h.Values {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+	for _, t := range types {
+		if seen[uint8(t)] {
+			continue
+		}
+		seen[uint8(t)] = true
+		if ew, ok := exHeaderWriters[uint8(t)]; ok {
+			if ew.needed(h) {
+				list = append(list, ExtendedHeader{Type: uint8(t), Data: ew.data(h)})
+			}
+			continue
+		}
+		handler, ok := customExHeader(uint8(t))
+		if !ok {
+			return nil, fmt.Errorf("lha: extended header 0x%02x is not registered", t)
+		}
+		d, _, err := writeCustomExHeader(h, handler, uint8(t), nil)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ExtendedHeader{Type: uint8(t), Data: d})
+	}
+	return list, nil
+}
+
+// headerFormat is options to write headers.
+type headerFormat struct {
+	// strict forbids upgrading levels.
+	strict bool
+	// location is a location of DOS timestamps.
+	location *time.Location
+}
+
+// headerMarshalers generates bytes of headers for each level.
+var headerMarshalers = map[uint8]func(h *Header, loc *time.Location) ([]byte, error){
+	0: marshalHeaderLv0,
+	1: marshalHeaderLv1,
+	2: func(h *Header, _ *time.Location) ([]byte, error) { return marshalHeaderLv2(h) },
+	3: func(h *Header, _ *time.Location) ([]byte, error) { return marshalHeaderLv3(h) },
+}
+
+// marshalHeader generates bytes of the header of h.Level.  When h can't be
+// represented in the level, because of a long name or 64-bit sizes, the
+// level is upgraded to 2 or 3 unless strict.
+func marshalHeader(h *Header, f headerFormat) ([]byte, error) {
+	if f.strict && h.Level == 0 {
+		if err := checkLv0Extra(h); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		marshal, ok := headerMarshalers[h.Level]
+		if !ok {
+			return nil, errUnsupportedLevel
+		}
+		b, err := marshal(h, f.location)
+		if err == nil || f.strict || h.Level >= 3 || !upgradable(err) {
+			return b, err
+		}
+		h.Level = max(h.Level+1, 2)
+	}
+}
+
+// lv0Types is types of extended headers, which are represented in level 0
+// header: the header CRC is replaced by the checksum, the path and the comment
+// are in the name, and UNIX fields are in UNIX extension.  DOS attribute
+// (0x40) isn't, because it is 16 bits and may differ from Attribute.
+var lv0Types = map[uint8]bool{
+	0x00: true, 0x01: true, 0x02: true, 0x3f: true,
+	0x50: true, 0x51: true, 0x54: true,
+}
+
+// checkLv0Extra returns an error when level 0 header drops some of extended
+// headers of h.
+func checkLv0Extra(h *Header) error {
+	exts, err := extendedHeaders(h)
+	if err != nil {
+		return err
+	}
+	for _, x := range exts {
+		if !lv0Types[x.Type] {
+			return fmt.Errorf("%w: 0x%02x", errDropExtra, x.Type)
+		}
+	}
+	return nil
+}
+
+func upgradable(err error) bool {
+	return errors.Is(err, errTooLongName) || errors.Is(err, errTooLargeSize) ||
+		errors.Is(err, errTooLargeHeader) || errors.Is(err, errTooLargeExtData)
+}
+
+// appendBaseHeader appends fields which are common to all levels: method,
+// sizes, time and attribute.  Sizes are truncated to 32 bits.
+func appendBaseHeader(b []byte, h *Header, t uint32) []byte {
+	var method [5]byte
+	copy(method[:], h.Method)
+	b = append(b, method[:]...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.PackedSize))
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.OriginalSize))
+	b = binary.LittleEndian.AppendUint32(b, t)
+	attr := h.Attribute
+	if attr == 0 {
+		attr = 0x20
+	}
+	return append(b, attr)
+}
+
+// appendExtendedHeaders appends exts to b, with "next size" fields of width
+// bytes.  The first "next size" field is appended too.  It returns total
+// size of exts, and position of header CRC (-1 when absent).
+func appendExtendedHeaders(b []byte, exts []ExtendedHeader, width int) ([]byte, uint64, int, error) {
+	var exSize uint64
+	crcPos := -1
+	for _, x := range exts {
+		n := len(x.Data) + 1 + width
+		if width == 2 {
+			if n > math.MaxUint16 {
+				return nil, 0, 0, errTooLargeExtData
+			}
+			b = binary.LittleEndian.AppendUint16(b, uint16(n))
+		} else {
+			if uint64(n) > math.MaxUint32 {
+				return nil, 0, 0, errTooLargeExtData
+			}
+			b = binary.LittleEndian.AppendUint32(b, uint32(n))
+		}
+		if x.Type == 0x00 && crcPos < 0 {
+			crcPos = len(b) + 1
+		}
+		b = append(b, x.Type)
+		b = append(b, x.Data...)
+		exSize += uint64(n)
+	}
+	if width == 2 {
+		b = binary.LittleEndian.AppendUint16(b, 0)
+	} else {
+		b = binary.LittleEndian.AppendUint32(b, 0)
+	}
+	return b, exSize, crcPos, nil
+}
+
+// setHeaderCRC calculates CRC of whole header b, and puts it at crcPos of b
+// and the header CRC extended header in exts.
+func setHeaderCRC(h *Header, b []byte, exts []ExtendedHeader, crcPos int) {
+	if crcPos < 0 {
+		h.HeaderCRC = nil
+		return
+	}
+	b[crcPos], b[crcPos+1] = 0, 0
+	crc := crc16.Checksum(b, crc16.IBMTable)
+	binary.LittleEndian.PutUint16(b[crcPos:], crc)
+	h.HeaderCRC = &crc
+	for i := range exts {
+		if exts[i].Type == 0x00 {
+			exts[i].Data = binary.LittleEndian.AppendUint16(nil, crc)
+			break
+		}
+	}
+}
+
+// headerSum calculates 8-bit checksum of level 0 and 1 headers.
+func headerSum(b []byte) uint8 {
+	var sum uint8
+	for _, c := range b {
+		sum += c
+	}
+	return sum
+}
+
+// dosTimestamp returns DOS timestamp of h in loc.  The raw value read from an
+// archive is kept while Time isn't modified, so copied headers are identical
+// even if the value is out of range or loc differs.
+func dosTimestamp(h *Header, loc *time.Location) uint32 {
+	if h.DOS.RawTime != 0 && h.Time.Equal(h.DOS.Time) {
+		return h.DOS.RawTime
+	}
+	return toDOSTimestamp(h.Time, loc)
+}
+
+// lvNameWithComment returns name field of level 0 and 1 headers, which has
+// a comment after NUL.
+func lvNameWithComment(name string, h *Header) string {
+	if h.Comment != "" {
+		return name + "\x00" + h.Comment
+	}
+	return name
+}
+
+// marshalHeaderLv0 generates bytes of level 0 header from h.  The path is
+// stored in the name with "/" separators.  UNIX extension is added when h
+// has UNIX permission, owner or time, otherwise generic extension is used.
+func marshalHeaderLv0(h *Header, loc *time.Location) ([]byte, error) {
+	if h.PackedSize > math.MaxUint32 || h.OriginalSize > math.MaxUint32 {
+		return nil, errTooLargeSize
+	}
+	name := h.Name
+	if dir := strings.Trim(filepath.ToSlash(h.Dir), "/"); dir != "" {
+		name = dir + "/" + name
+	}
+	name = lvNameWithComment(name, h)
+	unix := h.UNIX.Perm != 0 || h.UNIX.UID != 0 || h.UNIX.GID != 0 || !h.UNIX.Time.IsZero()
+	size := 22 + len(name)
+	if unix {
+		size += 12
+	}
+	if len(name) > math.MaxUint8 || size > math.MaxUint8 {
+		return nil, errTooLongName
+	}
+	b := make([]byte, 2, size+2)
+	b = appendBaseHeader(b, h, dosTimestamp(h, loc))
+	b = append(b, 0, byte(len(name)))
+	b = append(b, name...)
+	b = binary.LittleEndian.AppendUint16(b, h.CRC)
+	h.ExtendType = ExtendGeneric
+	if unix {
+		h.ExtendType = ExtendUNIX
+		ut := h.UNIX.Time
+		if ut.IsZero() {
+			ut = h.Time
+		}
+		b = append(b, byte(ExtendUNIX), h.MinorVersion)
+		t, err := unixTime32(ut)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.LittleEndian.AppendUint32(b, t)
+		b = binary.LittleEndian.AppendUint16(b, h.UNIX.Perm)
+		b = binary.LittleEndian.AppendUint16(b, h.UNIX.UID)
+		b = binary.LittleEndian.AppendUint16(b, h.UNIX.GID)
+	}
+	b[0] = byte(size)
+	b[1] = headerSum(b[2:])
+	h.DOS.RawTime = binary.LittleEndian.Uint32(b[15:])
+	h.Level = 0
+	h.Attribute = b[19]
+	h.Size = uint16(size)
+	h.Sum = b[1]
+	h.HeaderCRC = nil
+	h.ExtendedHeaderSize = 0
+	h.Extra = nil
+	return b, nil
+}
+
+// lv1ExcludedTypes is types of extended headers, which are not written in
+// level 1 header.  The name and the comment are in the base header, and
+// level 1 header has the checksum instead of CRC.
+var lv1ExcludedTypes = map[uint8]bool{0x00: true, 0x01: true, 0x3f: true}
+
+// marshalHeaderLv1 generates bytes of level 1 header from h.  PackedSize of
+// h is updated to include size of extended headers.
+func marshalHeaderLv1(h *Header, loc *time.Location) ([]byte, error) {
+	if h.PackedSize > math.MaxUint32 || h.OriginalSize > math.MaxUint32 {
+		return nil, errTooLargeSize
+	}
+	name := lvNameWithComment(h.Name, h)
+	size := 25 + len(name)
+	if size > math.MaxUint8 {
+		return nil, errTooLongName
+	}
+	all, err := extendedHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+	var exts []ExtendedHeader
+	for _, x := range all {
+		if !lv1ExcludedTypes[x.Type] {
+			exts = append(exts, x)
+		}
+	}
+	b := make([]byte, 2, 256)
+	b = appendBaseHeader(b, h, dosTimestamp(h, loc))
+	b = append(b, 1, byte(len(name)))
+	b = append(b, name...)
+	b = binary.LittleEndian.AppendUint16(b, h.CRC)
+	b = append(b, h.OSID)
+	b, exSize, _, err := appendExtendedHeaders(b, exts, 2)
+	if err != nil {
+		return nil, err
+	}
+	packedSize := h.PackedSize + exSize
+	if packedSize > math.MaxUint32 {
+		return nil, errTooLargeSize
+	}
+	binary.LittleEndian.PutUint32(b[7:], uint32(packedSize))
+	b[0] = byte(size)
+	b[1] = headerSum(b[2 : size+2])
+	h.DOS.RawTime = binary.LittleEndian.Uint32(b[15:])
+	h.Level = 1
+	h.Attribute = b[19]
+	h.Size = uint16(size)
+	h.Sum = b[1]
+	h.PackedSize = packedSize
+	h.HeaderCRC = nil
+	h.ExtendedHeaderSize = exSize
+	h.Extra = exts
+	return b, nil
+}
+
+// marshalHeaderLv2 generates bytes of level 2 header from h.  It updates
+// Size, HeaderCRC, ExtendedHeaderSize and Extra of h, to represent the
+// generated header.
+func marshalHeaderLv2(h *Header) ([]byte, error) {
+	exts, err := extendedHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+	t, err := unixTime32(h.Time)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 2, 256)
+	b = appendBaseHeader(b, h, t)
+	b = append(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, h.CRC)
+	b = append(b, h.OSID)
+	b, exSize, crcPos, err := appendExtendedHeaders(b, exts, 2)
+	if err != nil {
+		return nil, err
+	}
+	// a header which size is multiple of 256 is padded, because the first
+	// byte 0 means end of archive.
+	if len(b)&0xff == 0 {
+		b = append(b, 0)
+	}
+	if len(b) > math.MaxUint16 {
+		return nil, errTooLargeHeader
+	}
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	setHeaderCRC(h, b, exts, crcPos)
+	h.Level = 2
+	h.Attribute = b[19]
+	h.Size = uint16(len(b))
+	h.ExtendedHeaderSize = exSize
+	h.Extra = exts
+	return b, nil
+}
+
+// marshalHeaderLv3 generates bytes of level 3 header from h, which has
+// 32-bit sizes of the header and extended headers.
+func marshalHeaderLv3(h *Header) ([]byte, error) {
+	exts, err := extendedHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+	t, err := unixTime32(h.Time)
+	if err != nil {
+		return nil, err
+	}
+	b := binary.LittleEndian.AppendUint16(make([]byte, 0, 256), 4)
+	b = appendBaseHeader(b, h, t)
+	b = append(b, 3)
+	b = binary.LittleEndian.AppendUint16(b, h.CRC)
+	b = append(b, h.OSID)
+	// total size of the header is put later.
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b, exSize, crcPos, err := appendExtendedHeaders(b, exts, 4)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(b)) > math.MaxUint32 {
+		return nil, errTooLargeHeader
+	}
+	binary.LittleEndian.PutUint32(b[24:], uint32(len(b)))
+	setHeaderCRC(h, b, exts, crcPos)
+	h.Level = 3
+	h.Attribute = b[19]
+	h.Size = 4
+	h.ExtendedHeaderSize = exSize
+	h.Extra = exts
+	return b, nil
+}
@@ -0,0 +1,395 @@
+package lha
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koron-go/lha/crc16"
+	"github.com/koron-go/lha/internal/assert"
+)
+
+func testReadAll(t *testing.T, b []byte) ([]*Header, [][]byte) {
+	t.Helper()
+	r := NewReader(bytes.NewReader(b))
+	var (
+		headers []*Header
+		bodies  [][]byte
+	)
+	for {
+		h, err := r.NextHeader()
+		if err != nil {
+			t.Fatalf("NextHeader failed: %s", err)
+		}
+		if h == nil {
+			return headers, bodies
+		}
+		var body bytes.Buffer
+		if _, err := r.Decode(&body); err != nil {
+			t.Fatalf("Decode failed: %s", err)
+		}
+		headers = append(headers, h)
+		bodies = append(bodies, body.Bytes())
+	}
+}
+
+func TestMarshalHeaderLv2_RoundTrip(t *testing.T) {
+	raw, err := os.ReadFile("testdata/header-lv2.lzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, _ := testReadAll(t, raw)
+	if len(headers) != 1 {
+		t.Fatalf("unexpected number of headers: %d", len(headers))
+	}
+	h := headers[0]
+	want := raw[:h.Size]
+	got, err := marshalHeaderLv2(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestWriter_Extra(t *testing.T) {
+	unknown := ExtendedHeader{Type: 0x7e, Data: []byte("opaque\x00data")}
+	h := &Header{
+		Method: "-lh0-",
+		Time:   time.Unix(1128875494, 0),
+		OSID:   'U',
+		Name:   "foo.txt",
+		Dir:    "dir",
+		Extra: []ExtendedHeader{
+			{Type: 0x01, Data: []byte("stale.txt")},
+			unknown,
+			// dropped: no group in h.
+			{Type: 0x52, Data: []byte("staff")},
+		},
+		UNIX: HeaderUNIX{Perm: 0100644, UID: 501, GID: 20},
+	}
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	fw, err := w.CreateHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "Hello LHA\n")
+	if _, err := w.Create("bar/baz.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, bodies := testReadAll(t, b.Bytes())
+	assert.Equal(t, 2, len(headers))
+	assert.Equal(t, "Hello LHA\n", string(bodies[0]))
+	assert.Equal(t, "", string(bodies[1]))
+	got := headers[0]
+	assert.Equal(t, h.Extra, got.Extra)
+	assert.Equal(t, []ExtendedHeader{
+		{Type: 0x01, Data: []byte("foo.txt")},
+		unknown,
+		{Type: 0x00, Data: h.Extra[2].Data},
+		{Type: 0x02, Data: []byte("dir\xff")},
+		{Type: 0x50, Data: []byte{0xa4, 0x81}},
+		{Type: 0x51, Data: []byte{20, 0, 0xf5, 0x01}},
+	}, got.Extra)
+	assert.Equal(t, "foo.txt", got.Name)
+	assert.Equal(t, "dir/", got.Dir)
+	assert.Equal(t, uint16(501), got.UNIX.UID)
+	assert.Equal(t, crc16.Checksum([]byte("Hello LHA\n"), crc16.IBMTable), got.CRC)
+	assert.Equal(t, "baz.txt", headers[1].Name)
+	assert.Equal(t, "bar/", headers[1].Dir)
+
+	// rewrite the read header, to check round trip of unknown types.
+	var b2 bytes.Buffer
+	w2 := NewWriter(&b2)
+	fw, err = w2.CreateHeader(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "Hello LHA\n")
+	if err := w2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b.Bytes()[:got.Size], b2.Bytes()[:got.Size])
+}
+
+func TestWriter_Test(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if _, err := w.CreateHeader(&Header{Method: "-lhd-", Name: "dir"}); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.Create("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "content")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := Test(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rp.OK() {
+		t.Fatalf("archive is not OK: %+v", rp)
+	}
+	assert.Equal(t, []Status{StatusOK, StatusOK}, testStatuses(rp))
+}
+
+func TestWriter_Levels(t *testing.T) {
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.Local)
+	for _, lv := range []uint8{0, 1, 2, 3} {
+		t.Run(fmt.Sprintf("lv%d", lv), func(t *testing.T) {
+			var b bytes.Buffer
+			w := NewWriter(&b)
+			w.SetHeaderLevel(lv, true)
+			if _, err := w.CreateHeader(&Header{Method: "-lhd-", Dir: "sub/", Time: mtime}); err != nil {
+				t.Fatal(err)
+			}
+			fw, err := w.CreateHeader(&Header{
+				Method:  "-lh5-",
+				Dir:     "sub/",
+				Name:    "a.txt",
+				Comment: "comment",
+				Time:    mtime,
+				UNIX:    HeaderUNIX{Perm: 0100640, UID: 1000, GID: 100},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(fw, strings.Repeat("levels ", 100))
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			rp, err := Test(bytes.NewReader(b.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !rp.OK() {
+				t.Fatalf("archive is not OK: %+v", rp.Entries[len(rp.Entries)-1])
+			}
+			headers, bodies := testReadAll(t, b.Bytes())
+			assert.Equal(t, 2, len(headers))
+			for _, h := range headers {
+				assert.Equal(t, lv, h.Level)
+				assert.Equal(t, "sub/", filepath.ToSlash(h.Dir))
+				if !h.Time.Equal(mtime) {
+					t.Errorf("time mismatch: %s", h.Time)
+				}
+			}
+			h := headers[1]
+			assert.Equal(t, "a.txt", h.Name)
+			assert.Equal(t, "comment", h.Comment)
+			assert.Equal(t, HeaderUNIX{Perm: 0100640, UID: 1000, GID: 100, Time: h.UNIX.Time}, h.UNIX)
+			assert.Equal(t, strings.Repeat("levels ", 100), string(bodies[1]))
+			assert.Equal(t, lv >= 2, h.HeaderCRC != nil)
+			if lv == 0 {
+				assert.Equal(t, ExtendUNIX, h.ExtendType)
+			}
+		})
+	}
+}
+
+func TestWriter_LevelUpgrade(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	for _, tc := range []struct {
+		lv   uint8
+		h    Header
+		want uint8
+	}{
+		{0, Header{Name: long}, 2},
+		{1, Header{Name: long}, 2},
+		{1, Header{Name: "big", OriginalSize: 1 << 33}, 2},
+		{2, Header{Name: "a", Comment: strings.Repeat("c", 70000)}, 3},
+		{0, Header{Name: "short"}, 0},
+	} {
+		h := tc.h
+		h.Method = "-lh0-"
+		h.Level = tc.lv
+		if _, err := marshalHeader(&h, headerFormat{}); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.want, h.Level)
+
+		if tc.want == tc.lv {
+			continue
+		}
+		h = tc.h
+		h.Method = "-lh0-"
+		h.Level = tc.lv
+		if _, err := marshalHeader(&h, headerFormat{strict: true}); !upgradable(err) {
+			t.Fatalf("strict level %d should fail: %v", tc.lv, err)
+		}
+	}
+}
+
+func TestWriter_SetHeaderLevelBetweenFiles(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if _, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "default.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	w.SetHeaderLevel(0, false)
+	if _, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "lv0.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	headers, _ := testReadAll(t, b.Bytes())
+	assert.Equal(t, uint8(2), headers[0].Level)
+	assert.Equal(t, uint8(0), headers[1].Level)
+}
+
+func TestWriter_Lv0DropExtra(t *testing.T) {
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, tc := range []struct {
+		h    Header
+		fail bool
+	}{
+		{Header{Comment: "c", UNIX: HeaderUNIX{Perm: 0100644, UID: 1, Time: mtime}}, false},
+		{Header{Extra: []ExtendedHeader{{Type: 0x7f, Data: []byte("x")}}}, true},
+		{Header{UNIX: HeaderUNIX{User: "user"}}, true},
+		{Header{Windows: HeaderWindows{ModificationTime: mtime}}, true},
+		{Header{Attribute: 0x20, DOS: HeaderDOS{Attr: 0x20}}, true},
+	} {
+		h := tc.h
+		h.Method = "-lh0-"
+		h.Name = "a.txt"
+		_, err := marshalHeader(&h, headerFormat{strict: true})
+		if tc.fail != errors.Is(err, errDropExtra) {
+			t.Errorf("unexpected error for %+v: %v", tc.h, err)
+		}
+		// extended headers are dropped unless strict.
+		h = tc.h
+		h.Method = "-lh0-"
+		h.Name = "a.txt"
+		if _, err := marshalHeader(&h, headerFormat{}); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint8(0), h.Level)
+	}
+}
+
+func TestWriter_Lv0Path(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.SetHeaderLevel(0, false)
+	fw, err := w.Create("dir/sub/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "lv0")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the path is stored with slashes.
+	if !bytes.Contains(b.Bytes(), []byte("dir/sub/file.txt")) {
+		t.Fatal("path is not stored with slashes")
+	}
+	headers, _ := testReadAll(t, b.Bytes())
+	assert.Equal(t, "file.txt", headers[0].Name)
+	assert.Equal(t, "dir/sub/", filepath.ToSlash(headers[0].Dir))
+}
+
+func TestWriter_Lv0PathRoundTrip(t *testing.T) {
+	for _, h := range []Header{
+		{Method: "-lh0-", Dir: "sub/dir", Name: "file.txt"},
+		{Method: "-lhd-", Dir: "sub/dir/"},
+		{Method: "-lhd-", Dir: "sub", Name: "link|../a/b"},
+		{Method: "-lh0-", Dir: "sub", Name: "\x83\x5c.txt"},
+	} {
+		var got [2]*Header
+		for i, lv := range []uint8{0, 2} {
+			var b bytes.Buffer
+			w := NewWriter(&b)
+			w.SetHeaderLevel(lv, true)
+			h := h
+			if _, err := w.CreateHeader(&h); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			headers, _ := testReadAll(t, b.Bytes())
+			got[i] = headers[0]
+		}
+		// level 0 header reads back same path as level 2 header.
+		assert.Equal(t, got[1].Dir, got[0].Dir)
+		assert.Equal(t, got[1].Name, got[0].Name)
+		assert.Equal(t, h.Path(), got[0].Path())
+	}
+}
+
+func TestWriter_Location(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	mtime := time.Date(2005, 10, 15, 1, 31, 34, 0, jst)
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.SetHeaderLevel(1, true)
+	w.SetLocation(jst)
+	if _, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "a.txt", Time: mtime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, loc := range []*time.Location{jst, time.UTC} {
+		r := NewReaderWithOptions(bytes.NewReader(b.Bytes()), &ReaderOptions{Location: loc})
+		h, err := r.NextHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint32(0x334f0bf1), h.DOS.RawTime)
+		assert.Equal(t, "2005-10-15 01:31:34", h.DOS.Time.Format(time.DateTime))
+		assert.Equal(t, loc.String(), h.DOS.Time.Location().String())
+		assert.Equal(t, TimeSourceDOS, h.TimeSource)
+	}
+}
+
+func TestWriter_TimeRange(t *testing.T) {
+	for _, level := range []uint8{2, 3} {
+		// zero time is written as the UNIX epoch.
+		var b bytes.Buffer
+		w := NewWriter(&b)
+		w.SetHeaderLevel(level, true)
+		if _, err := w.CreateHeader(&Header{Method: "-lh0-", Name: "zero.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		headers, _ := testReadAll(t, b.Bytes())
+		assert.Equal(t, int64(0), headers[0].Time.Unix())
+	}
+
+	for _, tc := range []struct {
+		level uint8
+		h     Header
+	}{
+		{2, Header{Time: time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{2, Header{Time: time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{3, Header{Time: time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{1, Header{UNIX: HeaderUNIX{Time: time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC)}}},
+		{0, Header{UNIX: HeaderUNIX{Time: time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)}}},
+	} {
+		h := tc.h
+		h.Method = "-lh0-"
+		h.Name = "a.txt"
+		h.Level = tc.level
+		if _, err := marshalHeader(&h, headerFormat{strict: true}); err != errTimeOutOfRange {
+			t.Errorf("unexpected error for level %d %s: %v", tc.level, tc.h.Time, err)
+		}
+	}
+}